@@ -1,11 +1,9 @@
 package brewery
 
 import (
-	"github.com/cswank/gogadgets"
-)
+	"time"
 
-var (
-	vol *volumeManager
+	"github.com/cswank/gogadgets"
 )
 
 // Config holds brewery env vars
@@ -19,20 +17,159 @@ type Config struct {
 	C           float64
 	HLTCapacity float64
 
+	//HLTRadius and TunValveRadius (cm) and the discharge
+	//coefficient of the tun valve model the hlt draining
+	//into the tun by gravity.  They are used when A, B and C
+	//haven't been calibrated (see cmd/calibrate).
+	HLTRadius      float64 `split_words:"true"`
+	TunValveRadius float64 `split_words:"true"`
+	HLTCoefficient float64 `split_words:"true"`
+
+	//MashRadius and MashValveRadius are what HLTRadius and
+	//TunValveRadius used to be called, they are still read
+	//so that older env files keep working.
+	MashRadius      float64 `split_words:"true"`
+	MashValveRadius float64 `split_words:"true"`
+
+	//HLTWatts and BoilerWatts are the power of the heaters,
+	//they are used to predict how long it takes to reach a
+	//temperature.
+	HLTWatts    float64 `split_words:"true"`
+	BoilerWatts float64 `split_words:"true"`
+
+	//HLTHeaterVolume and BoilerHeaterVolume (gallons) are the
+	//least the heaters can fire with.  The interlock turns
+	//them off below that, and turns off transfers that would
+	//overfill a vessel.  Every trip is logged to InterlockLog.
+	HLTHeaterVolume    float64 `split_words:"true"`
+	BoilerHeaterVolume float64 `split_words:"true"`
+	InterlockLog       string  `split_words:"true"`
+
+	//HLTMaxTemperature (C) is the temperature the watchdog
+	//turns the hlt heater off at.  When the boiler is within
+	//a few degrees of BoilingPoint (C, 100 by default) and
+	//rising faster than BoilerMaxRise (C/min) the watchdog
+	//throttles its heater.  BoilingPoint is also where the
+	//hlt and boiler's thermal models stop getting hotter.
+	HLTMaxTemperature float64 `split_words:"true"`
+	BoilingPoint      float64 `split_words:"true"`
+	BoilerMaxRise     float64 `split_words:"true"`
+
 	//BoilerFIllTime is the time to drain the mash in seconds
 	BoilerFillTime  int
 	FloatSwitchPin  string
 	FloatSwitchPort string
+
+	//FlowMeterPin is the gpio of a flow meter on the tun
+	//valve and FlowMeterKFactor is how many times it pulses
+	//per liter.
+	FlowMeterPin     string  `split_words:"true"`
+	FlowMeterKFactor float64 `split_words:"true"`
+
+	//OvershootRate (0 to 1) is how quickly the overshoot
+	//past a "fill <vessel> to" target is learned.  When it
+	//is 0 the overshoot in the topology is used as is.
+	OvershootRate float64 `split_words:"true"`
+
+	//Units are what the tanks report volumes in: gallons
+	//(the default), liters or quarts.
+	Units string
+
+	//StateFile is where the volumes are saved so they can be
+	//restored after a restart.  Volumes saved longer than
+	//StateTimeout ago (12h by default) are ignored.
+	StateFile    string        `split_words:"true"`
+	StateTimeout time.Duration `split_words:"true"`
+
+	//CalibrationLog is where fills that end with the vessel
+	//being measured are logged, so that drift in the flow
+	//models can be found (see NewDrift).
+	CalibrationLog string `split_words:"true"`
+
+	//Topology is the path to a json file that declares the
+	//vessels and the transfers between them.  When it is empty
+	//(and Vessels isn't set) the hlt, tun, boiler and carboy
+	//setup is used.
+	Topology  string
+	Vessels   []Vessel   `ignored:"true"`
+	Transfers []Transfer `ignored:"true"`
+}
+
+// Brewery is a single brewing system.  It owns the volume
+// manager and the tanks that report its volumes, so more
+// than one can run in the same process.
+type Brewery struct {
+	vol       *volumeManager
+	tanks     []*Tank
+	interlock *Interlock
+	watchdog  *Watchdog
 }
 
-func New(cfg *Config, opts ...func(*volumeManager)) (*Tank, *Tank, *Tank, *Tank, error) {
-	var err error
-	vol, err = newVolumeManager(cfg, opts...)
+func New(cfg *Config, opts ...func(*volumeManager)) (*Brewery, error) {
+	top, err := cfg.topology()
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := newVolumeManager(cfg, top, opts...)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
 
-	return NewTank("hlt", masterTank), NewTank("tun"), NewTank("boiler"), NewTank("carboy"), nil
+	units := gallons
+	if cfg.Units != "" {
+		if units, err = volumeUnits(cfg.Units); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &Brewery{vol: vol, interlock: newInterlock(cfg, top), watchdog: newWatchdog(top)}
+	for i, v := range top.Vessels {
+		opts := []func(*Tank){tankUnits(units), tankThermal(v.Thermal)}
+		if v.Geometry != nil {
+			opts = append(opts, tankGeometry(v.Geometry))
+		}
+		if i == 0 {
+			//only one tank passes the bus messages on to the
+			//volume manager.
+			opts = append(opts, masterTank)
+		}
+		b.tanks = append(b.tanks, newTank(vol, v.Name, opts...))
+	}
+
+	return b, nil
+}
+
+// Tank returns the tank with the given name, or nil if this
+// brewery doesn't have one.
+func (b *Brewery) Tank(name string) *Tank {
+	for _, t := range b.tanks {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Interlock returns the brewery's safety interlock.
+func (b *Brewery) Interlock() *Interlock {
+	return b.interlock
+}
+
+// Watchdog returns the brewery's temperature watchdog.
+func (b *Brewery) Watchdog() *Watchdog {
+	return b.watchdog
+}
+
+// Gadgets returns the tanks, the interlock and the watchdog
+// as gogadgets.Gadgeters so they can be passed to
+// gogadgets.New.
+func (b *Brewery) Gadgets() []gogadgets.Gadgeter {
+	out := make([]gogadgets.Gadgeter, 0, len(b.tanks)+2)
+	for _, t := range b.tanks {
+		out = append(out, t)
+	}
+	return append(out, b.interlock, b.watchdog)
 }
 
 func WithAfter(a Afterer) func(*volumeManager) {
@@ -43,7 +180,15 @@ func WithAfter(a Afterer) func(*volumeManager) {
 
 func WithTimer(t Timer) func(*volumeManager) {
 	return func(v *volumeManager) {
-		v.timer = t
+		v.newTimer = func() Timer { return t }
+	}
+}
+
+// WithNewTimer is like WithTimer, but every transfer gets its
+// own Timer from f.
+func WithNewTimer(f func() Timer) func(*volumeManager) {
+	return func(v *volumeManager) {
+		v.newTimer = f
 	}
 }
 
@@ -52,3 +197,27 @@ func WithPoller(p gogadgets.Poller) func(*volumeManager) {
 		v.poller = p
 	}
 }
+
+// WithLevelSwitch replaces the gpio of the level switch on
+// pin with p.
+func WithLevelSwitch(pin string, p gogadgets.Poller) func(*volumeManager) {
+	return func(v *volumeManager) {
+		v.pollers[pin] = p
+	}
+}
+
+// WithFlowMeter measures the transfer done by gadget with
+// a flow meter that pulses whenever p's Wait returns.
+func WithFlowMeter(gadget string, p gogadgets.Poller) func(*volumeManager) {
+	return func(v *volumeManager) {
+		v.meters[gadget] = p
+	}
+}
+
+// WithPressureSensor replaces the adc of the pressure sensor
+// in vessel with s.
+func WithPressureSensor(vessel string, s PressureSensor) func(*volumeManager) {
+	return func(v *volumeManager) {
+		v.pressures[vessel] = s
+	}
+}
@@ -61,8 +61,9 @@ var _ = Describe("Brewery", func() {
 		out, in                   map[string]chan gogadgets.Message
 		after                     *FakeAfter
 		timer                     *fakeTimer
-		hlt, tun, boiler, carboy  *brewery.Tank
+		hlt, tun                  *brewery.Tank
 		cfg                       *brewery.Config
+		b                         *brewery.Brewery
 	)
 
 	BeforeEach(func() {
@@ -73,11 +74,13 @@ var _ = Describe("Brewery", func() {
 			"carboy": make(chan gogadgets.Message),
 		}
 
+		//buffered so that the tanks can publish updates that
+		//a spec isn't interested in.
 		in = map[string]chan gogadgets.Message{
-			"hlt":    make(chan gogadgets.Message),
-			"tun":    make(chan gogadgets.Message),
-			"boiler": make(chan gogadgets.Message),
-			"carboy": make(chan gogadgets.Message),
+			"hlt":    make(chan gogadgets.Message, 10),
+			"tun":    make(chan gogadgets.Message, 10),
+			"boiler": make(chan gogadgets.Message, 10),
+			"carboy": make(chan gogadgets.Message, 10),
 		}
 
 		afterTrigger = make(chan bool)
@@ -100,17 +103,28 @@ var _ = Describe("Brewery", func() {
 		}
 
 		var err error
-		hlt, tun, boiler, carboy, err = brewery.New(cfg, brewery.WithAfter(after.After), brewery.WithTimer(timer), brewery.WithPoller(poller))
+		b, err = brewery.New(cfg, brewery.WithAfter(after.After), brewery.WithTimer(timer), brewery.WithPoller(poller))
 		Expect(err).To(BeNil())
+		hlt, tun = b.Tank("hlt"), b.Tank("tun")
 	})
 
+	//next skips the volume uncertainty updates.
+	next := func(c chan gogadgets.Message) gogadgets.Message {
+		for {
+			msg := <-c
+			if msg.Name != "volume uncertainty" {
+				return msg
+			}
+		}
+	}
+
 	Context("hlt", func() {
 
 		BeforeEach(func() {
 
 			go hlt.Start(out["hlt"], in["hlt"])
 			//capture the initial values from startup
-			msg := <-in["hlt"]
+			msg := next(in["hlt"])
 			Expect(msg.Value.Value.(float64)).To(Equal(0.0))
 		})
 
@@ -126,7 +140,7 @@ var _ = Describe("Brewery", func() {
 			//fill hlt
 			pollTrigger <- true
 
-			msg := <-in["hlt"]
+			msg := next(in["hlt"])
 			Expect(msg.Value.Value.(float64)).To(Equal(cfg.HLTCapacity))
 		})
 	})
@@ -137,9 +151,9 @@ var _ = Describe("Brewery", func() {
 			go hlt.Start(out["hlt"], in["hlt"])
 			go tun.Start(out["tun"], in["tun"])
 			//capture the initial values from startup
-			msg := <-in["hlt"]
+			msg := next(in["hlt"])
 			Expect(msg.Value.Value.(float64)).To(Equal(0.0))
-			msg = <-in["tun"]
+			msg = next(in["tun"])
 			Expect(msg.Value.Value.(float64)).To(Equal(0.0))
 		})
 
@@ -155,7 +169,7 @@ var _ = Describe("Brewery", func() {
 			//fill hlt
 			pollTrigger <- true
 
-			msg := <-in["hlt"]
+			msg := next(in["hlt"])
 			Expect(msg.Value.Value.(float64)).To(Equal(cfg.HLTCapacity))
 
 			out["hlt"] <- gogadgets.Message{
@@ -167,16 +181,16 @@ var _ = Describe("Brewery", func() {
 			}
 
 			afterTrigger <- true
-			msg = <-in["hlt"]
-			Expect(msg.Value.Value.(float64)).To(Equal(6.4904387056582635))
-			msg = <-in["tun"]
-			Expect(msg.Value.Value.(float64)).To(Equal(0.5095612943417365))
+			msg = next(in["hlt"])
+			Expect(msg.Value.Value.(float64)).To(Equal(6.9915637017004615))
+			msg = next(in["tun"])
+			Expect(msg.Value.Value.(float64)).To(Equal(0.008436298299538712))
 
 			afterTrigger <- true
-			msg = <-in["hlt"]
-			Expect(msg.Value.Value.(float64)).To(Equal(6.000131447292215))
-			msg = <-in["tun"]
-			Expect(msg.Value.Value.(float64)).To(Equal(0.9998685527077844))
+			msg = next(in["hlt"])
+			Expect(msg.Value.Value.(float64)).To(Equal(6.983132490118674))
+			msg = next(in["tun"])
+			Expect(msg.Value.Value.(float64)).To(Equal(0.016867509881326022))
 
 			out["hlt"] <- gogadgets.Message{
 				Type:   "update",
@@ -186,10 +200,134 @@ var _ = Describe("Brewery", func() {
 				},
 			}
 
+			msg = next(in["hlt"])
+			Expect(msg.Value.Value.(float64)).To(Equal(6.974706365254643))
+			msg = next(in["tun"])
+			Expect(msg.Value.Value.(float64)).To(Equal(0.02529363474535713))
+		})
+	})
+
+	Context("target fill", func() {
+
+		BeforeEach(func() {
+			go hlt.Start(out["hlt"], in["hlt"])
+			go tun.Start(out["tun"], in["tun"])
+			next(in["hlt"])
+			next(in["tun"])
+		})
+
+		It("stops filling the tun when it reaches the target", func() {
+			out["hlt"] <- gogadgets.Message{
+				Type: "command",
+				Body: "set hlt volume to 7 gallons",
+			}
+			next(in["hlt"])
+
+			out["tun"] <- gogadgets.Message{
+				Type: "command",
+				Body: "fill tun to 0.02 gallons",
+			}
+
+			out["hlt"] <- gogadgets.Message{
+				Type:   "update",
+				Sender: "tun valve",
+				Value: gogadgets.Value{
+					Value: true,
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				afterTrigger <- true
+				next(in["hlt"])
+				msg := next(in["tun"])
+				Expect(msg.Value.Value.(float64)).To(BeNumerically("<", 0.02))
+			}
+
+			afterTrigger <- true
+			next(in["hlt"])
+			msg := next(in["tun"])
+			Expect(msg.Value.Value.(float64)).To(BeNumerically(">=", 0.02))
+
+			msg = next(in["hlt"])
+			Expect(msg.Type).To(Equal("command"))
+			Expect(msg.Body).To(Equal("stop filling tun"))
+		})
+	})
+
+	Context("uncertainty", func() {
+
+		BeforeEach(func() {
+			go hlt.Start(out["hlt"], in["hlt"])
+			go tun.Start(out["tun"], in["tun"])
+			<-in["hlt"]
+			<-in["tun"]
+		})
+
+		It("grows while the tun is filled and goes away when it is measured", func() {
+			out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 7 gallons"}
+			<-in["hlt"]
+
+			out["hlt"] <- gogadgets.Message{
+				Type:   "update",
+				Sender: "tun valve",
+				Value: gogadgets.Value{
+					Value: true,
+				},
+			}
+
+			afterTrigger <- true
+			<-in["hlt"]
+			msg := <-in["tun"]
+			vol := msg.Value.Value.(float64)
+
+			msg = <-in["tun"]
+			Expect(msg.Name).To(Equal("volume uncertainty"))
+			Expect(msg.Value.Value.(float64)).To(BeNumerically("~", 0.1*vol, 1e-9))
+			Expect(msg.Value.Units).To(Equal("gallons"))
+
 			msg = <-in["hlt"]
-			Expect(msg.Value.Value.(float64)).To(Equal(5.529078224901856))
+			Expect(msg.Name).To(Equal("volume uncertainty"))
+			Expect(msg.Value.Value.(float64)).To(BeNumerically("~", 0.1*vol, 1e-9))
+
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "set tun volume to 1 gallon"}
+			msg = <-in["tun"]
+			Expect(msg.Value.Value.(float64)).To(Equal(1.0))
 			msg = <-in["tun"]
-			Expect(msg.Value.Value.(float64)).To(Equal(1.4709217750981438))
+			Expect(msg.Name).To(Equal("volume uncertainty"))
+			Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+		})
+	})
+
+	Context("manual overrides", func() {
+
+		BeforeEach(func() {
+			go tun.Start(out["tun"], in["tun"])
+			msg := next(in["tun"])
+			Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+		})
+
+		command := func(body string) float64 {
+			out["tun"] <- gogadgets.Message{
+				Type: "command",
+				Body: body,
+			}
+			msg := next(in["tun"])
+			return msg.Value.Value.(float64)
+		}
+
+		It("sets, adds to and empties a vessel", func() {
+			Expect(command("set tun volume to 3.5 gallons")).To(Equal(3.5))
+			Expect(command("add 1 gallon to tun")).To(BeNumerically("~", 4.5, 1e-9))
+			Expect(command("add 2 liters to tun")).To(BeNumerically("~", 5.028, 0.001))
+			Expect(command("empty tun")).To(Equal(0.0))
+		})
+
+		It("ignores commands for other vessels", func() {
+			out["tun"] <- gogadgets.Message{
+				Type: "command",
+				Body: "set boiler volume to 3.5 gallons",
+			}
+			Expect(command("add 1 gallon to tun")).To(Equal(1.0))
 		})
 	})
 })
@@ -0,0 +1,118 @@
+package brewery
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Residual is how far a flow model's prediction is from a
+// measured point (ml).
+type Residual struct {
+	FlowPoint
+	Predicted float64
+	Residual  float64
+}
+
+// FitPolynomial finds the least squares fit of a polynomial of
+// the given degree to measured points.  A degree of 2 gives
+// the A, B and C of Config.
+func FitPolynomial(pts []FlowPoint, degree int) (Polynomial, error) {
+	n := degree + 1
+	if degree < 0 {
+		return nil, fmt.Errorf("invalid degree %d", degree)
+	}
+
+	if len(pts) < n {
+		return nil, fmt.Errorf("a degree %d fit needs at least %d points, got %d", degree, n, len(pts))
+	}
+
+	//the normal equations (X^T X) c = X^T y as an augmented
+	//matrix.
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n+1)
+	}
+
+	for _, p := range pts {
+		pows := make([]float64, 2*n)
+		pows[0] = 1
+		for i := 1; i < len(pows); i++ {
+			pows[i] = pows[i-1] * p.Time
+		}
+
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				m[i][j] += pows[i+j]
+			}
+			m[i][n] += pows[i] * p.Volume
+		}
+	}
+
+	c, err := solve(m)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fit the points: %s", err)
+	}
+	return Polynomial(c), nil
+}
+
+// solve does gaussian elimination (with partial pivoting) on
+// an augmented matrix.
+func solve(m [][]float64) ([]float64, error) {
+	n := len(m)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("the points don't determine a unique fit")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < n; row++ {
+			f := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		x[row] = m[row][n]
+		for k := row + 1; k < n; k++ {
+			x[row] -= m[row][k] * x[k]
+		}
+		x[row] /= m[row][row]
+	}
+	return x, nil
+}
+
+// Residuals compares a flow model with measured points.  start
+// is the volume (ml) in the source vessel when the points
+// were measured.
+func Residuals(f FlowModel, pts []FlowPoint, start float64) []Residual {
+	out := make([]Residual, len(pts))
+	for i, p := range pts {
+		y := f.Volume(time.Duration(p.Time*float64(time.Second)), start)
+		out[i] = Residual{FlowPoint: p, Predicted: y, Residual: p.Volume - y}
+	}
+	return out
+}
+
+// RMS is the root mean square of the residuals (ml).
+func RMS(res []Residual) float64 {
+	if len(res) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, r := range res {
+		sum += r.Residual * r.Residual
+	}
+	return math.Sqrt(sum / float64(len(res)))
+}
@@ -0,0 +1,56 @@
+package brewery_test
+
+import (
+	"github.com/cswank/brewery"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Calibration", func() {
+	It("fits a quadratic to measured points", func() {
+		var pts []brewery.FlowPoint
+		for _, t := range []float64{10, 20, 30, 40, 50, 60} {
+			pts = append(pts, brewery.FlowPoint{Time: t, Volume: 5.0 + 130.0*t - 0.4*t*t})
+		}
+
+		p, err := brewery.FitPolynomial(pts, 2)
+		Expect(err).To(BeNil())
+		Expect(p).To(HaveLen(3))
+		Expect(p[0]).To(BeNumerically("~", 5.0, 1e-6))
+		Expect(p[1]).To(BeNumerically("~", 130.0, 1e-6))
+		Expect(p[2]).To(BeNumerically("~", -0.4, 1e-6))
+
+		res := brewery.Residuals(p, pts, 0)
+		Expect(res).To(HaveLen(6))
+		Expect(brewery.RMS(res)).To(BeNumerically("<", 1e-6))
+	})
+
+	It("reports the residuals of a noisy fit", func() {
+		pts := []brewery.FlowPoint{
+			{Time: 10, Volume: 100},
+			{Time: 20, Volume: 210},
+			{Time: 30, Volume: 290},
+			{Time: 40, Volume: 400},
+		}
+
+		p, err := brewery.FitPolynomial(pts, 1)
+		Expect(err).To(BeNil())
+
+		res := brewery.Residuals(p, pts, 0)
+		var sum float64
+		for _, r := range res {
+			sum += r.Residual
+			Expect(r.Predicted + r.Residual).To(BeNumerically("~", r.Volume, 1e-9))
+		}
+		Expect(sum).To(BeNumerically("~", 0, 1e-9))
+		Expect(brewery.RMS(res)).To(BeNumerically(">", 0))
+	})
+
+	It("needs enough points", func() {
+		_, err := brewery.FitPolynomial([]brewery.FlowPoint{{Time: 10, Volume: 100}}, 2)
+		Expect(err).ToNot(BeNil())
+
+		_, err = brewery.FitPolynomial([]brewery.FlowPoint{{Time: 10, Volume: 100}, {Time: 10, Volume: 110}, {Time: 10, Volume: 90}}, 2)
+		Expect(err).ToNot(BeNil())
+	})
+})
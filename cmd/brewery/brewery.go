@@ -1,37 +1,159 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/cswank/brewery"
+	"github.com/cswank/brewery/recipes"
 	"github.com/cswank/gogadgets"
 	"github.com/kelseyhightower/envconfig"
 )
 
 var (
-	cfg = flag.String("c", "", "Path to the gogadgets config json file")
+	cfg      = flag.String("c", "", "Path to the gogadgets config json file")
+	simulate = flag.Bool("simulate", false, "Simulate the gadgets instead of using the gpio")
+	scale    = flag.Float64("scale", 60, "How many times faster than real time a simulation runs")
+	recipe   = flag.String("recipe", "", "Path to a recipe (Brewtoad json, BeerXML or BeerJSON) whose method is run by the (first) brewery")
+	grain    = flag.Float64("grain-temperature", 70, "The temperature of the recipe's grains (F)")
+	ratio    = flag.Float64("ratio", 1.25, "The grain/water ratio of the recipe's mash")
+	systems  systemFlags
 )
 
+func init() {
+	flag.Var(&systems, "s", "A brewing system as <env prefix>=<gogadgets config json file>, may be repeated")
+}
+
+// systemFlags lets more than one brewery run in the same
+// process, each with its own env vars and gogadgets config.
+type systemFlags []string
+
+func (s *systemFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *systemFlags) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("invalid system %q, expected <env prefix>=<config path>", v)
+	}
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
 	flag.Parse()
-	var brewCfg brewery.Config
-	if err := envconfig.Process("brewery", &brewCfg); err != nil {
-		log.Fatal(err)
+	if flag.NArg() >= 2 && flag.Arg(0) == "calibrate" && flag.Arg(1) == "report" {
+		if err := calibrateReport(flag.Args()[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(systems) == 0 {
+		systems = systemFlags{fmt.Sprintf("brewery=%s", *cfg)}
 	}
 
-	a, err := getApp(*cfg, &brewCfg)
+	apps := make([]*gogadgets.App, len(systems))
+	for i, s := range systems {
+		parts := strings.SplitN(s, "=", 2)
+		var brewCfg brewery.Config
+		if err := envconfig.Process(parts[0], &brewCfg); err != nil {
+			log.Fatal(err)
+		}
+
+		var r *recipes.Recipe
+		if i == 0 && *recipe != "" {
+			var err error
+			if r, err = getRecipe(*recipe); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		a, err := getApp(parts[1], &brewCfg, r)
+		if err != nil {
+			log.Fatal(err)
+		}
+		apps[i] = a
+	}
+
+	for _, a := range apps[1:] {
+		go a.Start()
+	}
+	apps[0].Start()
+}
+
+// getRecipe reads the recipe at pth.  Its method is submitted
+// to the method runner once the app starts.
+func getRecipe(pth string) (*recipes.Recipe, error) {
+	f, err := os.Open(pth)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	a.Start()
+	defer f.Close()
+
+	r, err := recipes.Load(f, recipes.WaterRatio(*ratio))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pth, err)
+	}
+
+	return r, nil
 }
 
-func getApp(cfg interface{}, brewCfg *brewery.Config) (*gogadgets.App, error) {
-	hlt, tun, boiler, carboy, err := brewery.New(brewCfg)
+func getApp(cfg string, brewCfg *brewery.Config, r *recipes.Recipe) (*gogadgets.App, error) {
+	if *simulate {
+		return getSimulatedApp(cfg, brewCfg, r)
+	}
+
+	b, err := brewery.New(brewCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	gadgets := b.Gadgets()
+	if r != nil {
+		gadgets = append(gadgets, brewery.NewMethod(r.Name, r.Method(*grain)))
+	}
+	return gogadgets.New(cfg, gadgets...), nil
+}
+
+// getSimulatedApp replaces the gadgets in the gogadgets config
+// with simulated ones.  The state file and the calibration and
+// interlock logs are ignored so that a simulation never clobbers
+// the volumes, flow measurements or trips of a real brew, and
+// the waits of the recipe's method are sped up.
+func getSimulatedApp(cfg string, brewCfg *brewery.Config, r *recipes.Recipe) (*gogadgets.App, error) {
+	f, err := os.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var gCfg gogadgets.Config
+	if err := json.NewDecoder(f).Decode(&gCfg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", cfg, err)
+	}
+
+	sim, err := brewery.NewSimulator(brewCfg, gCfg.Gadgets, *scale)
 	if err != nil {
 		return nil, err
 	}
 
-	return gogadgets.New(cfg, hlt, tun, boiler, carboy), nil
+	brewCfg.StateFile = ""
+	brewCfg.CalibrationLog = ""
+	brewCfg.InterlockLog = ""
+	b, err := brewery.New(brewCfg, sim.Options()...)
+	if err != nil {
+		return nil, err
+	}
+
+	gCfg.Gadgets = nil
+	go sim.Start()
+	gadgets := append(b.Gadgets(), sim.Gadgets()...)
+	if r != nil {
+		gadgets = append(gadgets, brewery.NewMethod(r.Name, sim.Steps(r.Method(*grain))))
+	}
+	return gogadgets.New(&gCfg, gadgets...), nil
 }
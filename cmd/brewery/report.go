@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cswank/brewery"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// calibrateReport is the "calibrate report" command, it shows
+// how the flow models' predictions have drifted.
+func calibrateReport(args []string) error {
+	var cfg brewery.Config
+	if err := envconfig.Process("brewery", &cfg); err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("calibrate report", flag.ExitOnError)
+	pth := fs.String("log", cfg.CalibrationLog, "Path to the calibration log")
+	recent := fs.Int("recent", 5, "How many of the most recent fills are used for the error and refit")
+	threshold := fs.Float64("threshold", 0.05, "The error (as a fraction) at which a refit is suggested")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *pth == "" {
+		return fmt.Errorf("no calibration log, set BREWERY_CALIBRATION_LOG or -log")
+	}
+
+	f, err := os.Open(*pth)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := brewery.ReadCalibrationLog(f)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range brewery.NewDrift(records, *recent, *threshold) {
+		fmt.Printf("%s\n\n", d.Gadget)
+		fmt.Printf("%-20s %-10s %8s %12s %12s %8s\n", "time", "vessel", "elapsed", "predicted", "actual", "error")
+		for _, r := range d.Records {
+			fmt.Printf("%-20s %-10s %8.1f %12.1f %12.1f %7.1f%%\n", r.Time.Format("2006-01-02 15:04:05"), r.Vessel, r.Elapsed, r.Predicted, r.Actual, r.Error()*100)
+		}
+
+		fmt.Printf("\nerror of the last %d fills: %.1f%%\n", *recent, d.Error*100)
+		switch {
+		case d.Refit != nil:
+			fmt.Println("the error is over the threshold, suggested coefficients:")
+			for i, c := range d.Refit {
+				fmt.Printf("  x^%d: %g\n", i, c)
+			}
+		case (d.Error > *threshold || d.Error < -*threshold) && d.Flow != "polynomial":
+			fmt.Println("the error is over the threshold, but only polynomial flows are refit, recalibrate the flow")
+		case d.Error > *threshold || d.Error < -*threshold:
+			fmt.Println("the error is over the threshold, but there aren't enough different fills to refit")
+		}
+		fmt.Println()
+	}
+	return nil
+}
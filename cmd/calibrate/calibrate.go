@@ -1,51 +1,268 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/cswank/brewery"
 	"github.com/cswank/gogadgets"
 )
 
 var (
-	configPath  = flag.String("c", "", "Path to the config json file")
-	hltVolume   = flag.Float64("V", 0.0, "HLT Volume")
-	mashRadius  = flag.Float64("r", 0.0, "mash tun radius")
-	valveRadius = flag.Float64("v", 0.0, "mash tun valve radius")
+	configPath = flag.String("c", "", "Path to the gogadgets config json file")
+	location   = flag.String("l", "tun", "Location of the valve to calibrate")
+	name       = flag.String("n", "valve", "Name of the valve to calibrate")
+	pulse      = flag.Duration("p", 10*time.Second, "How long the valve is opened for each pulse")
+	pulses     = flag.Int("pulses", 6, "Number of pulses")
+	units      = flag.String("u", "gallons", "Units the measured volumes are entered in")
+	degree     = flag.Int("d", 2, "Degree of the polynomial that is fit")
+	meterPin   = flag.String("meter", "", "Read the volumes from the flow meter on this gpio pin instead of asking")
+	kFactor    = flag.Float64("k", 0, "Pulses per liter of the flow meter")
+	envPath    = flag.String("env", "", "Set BREWERY_A, BREWERY_B and BREWERY_C in this env file")
+	prefix     = flag.String("prefix", "BREWERY", "Env var prefix of the brewery")
+	topology   = flag.String("topology", "", "Update the flow of the valve's transfer in this topology json file")
 )
 
 func main() {
 	flag.Parse()
-	if !gogadgets.FileExists("/sys/bus/w1/devices/28-0000047ade8f") {
-		ioutil.WriteFile("/sys/devices/bone_capemgr.9/slots", []byte("BB-W1:00A0"), 0666)
+
+	valve, err := getValve()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	measure, err := getMeasure()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var pts []brewery.FlowPoint
+	for i := 1; i <= *pulses; i++ {
+		if err := valve.On(nil); err != nil {
+			log.Fatal(err)
+		}
+		time.Sleep(*pulse)
+		if err := valve.Off(); err != nil {
+			log.Fatal(err)
+		}
+
+		elapsed := time.Duration(i) * *pulse
+		ml, err := measure(elapsed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pts = append(pts, brewery.FlowPoint{Time: elapsed.Seconds(), Volume: ml})
+	}
+
+	p, err := brewery.FitPolynomial(pts, *degree)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report(p, pts)
+
+	if *envPath != "" {
+		if err := writeEnv(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *topology != "" {
+		if err := writeTopology(p); err != nil {
+			log.Fatal(err)
+		}
 	}
+}
+
+func getValve() (gogadgets.OutputDevice, error) {
 	b, err := ioutil.ReadFile(*configPath)
 	if err != nil {
-		panic(err)
-	}
-	cfg := &gogadgets.Config{}
-	err = json.Unmarshal(b, cfg)
-	for _, config := range cfg.Gadgets {
-		if config.Location == "mash tun" && config.Name == "valve" {
-			gpio, err := gogadgets.NewGPIO(&config.Pin)
-			if err == nil {
-				cfg := &brewery.MashConfig{
-					TankRadius:  *mashRadius,
-					ValveRadius: *valveRadius,
-				}
-				dev, mashErr := brewgadgets.NewMash(cfg)
-				mash := dev.(*brewgadgets.Mash)
-				mash.HLTVolume = *hltVolume
-				if mashErr == nil {
-					brewgadgets.Calibrate(mash, gpio)
-				} else {
-					fmt.Println(mashErr)
+		return nil, err
+	}
+
+	var cfg gogadgets.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+
+	for _, g := range cfg.Gadgets {
+		if g.Location == *location && g.Name == *name {
+			return gogadgets.NewGPIO(&g.Pin)
+		}
+	}
+	return nil, fmt.Errorf("there is no %s %s in %s", *location, *name, *configPath)
+}
+
+// getMeasure returns how the total volume (ml) that has gone
+// through the valve is measured after each pulse, either by
+// the flow meter or by asking.
+func getMeasure() (func(time.Duration) (float64, error), error) {
+	if *meterPin == "" {
+		return ask, nil
+	}
+
+	if *kFactor <= 0 {
+		return nil, fmt.Errorf("the flow meter needs a k-factor (-k)")
+	}
+
+	g, err := gogadgets.NewGPIO(&gogadgets.Pin{
+		Pin:       *meterPin,
+		Platform:  "rpi",
+		Direction: "in",
+		Edge:      "rising",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		lock  sync.Mutex
+		count int
+	)
+
+	go func() {
+		p := g.(*gogadgets.GPIO)
+		for {
+			if _, err := p.Wait(); err != nil {
+				log.Println("flow meter Wait() error:", err)
+				return
+			}
+			lock.Lock()
+			count++
+			lock.Unlock()
+		}
+	}()
+
+	return func(time.Duration) (float64, error) {
+		//let the last of the water through the meter.
+		time.Sleep(2 * time.Second)
+		lock.Lock()
+		defer lock.Unlock()
+		return float64(count) / *kFactor * 1000.0, nil
+	}, nil
+}
+
+var stdin = bufio.NewScanner(os.Stdin)
+
+func ask(elapsed time.Duration) (float64, error) {
+	for {
+		fmt.Printf("total volume in %s after %s (%s): ", *location, elapsed, *units)
+		if !stdin.Scan() {
+			return 0, fmt.Errorf("no volume entered")
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(stdin.Text()), 64)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return brewery.ToML(v, *units)
+	}
+}
+
+func report(p brewery.Polynomial, pts []brewery.FlowPoint) {
+	fmt.Println("\ncoefficients (time in s, volume in ml):")
+	for i, c := range p {
+		fmt.Printf("  x^%d: %g\n", i, c)
+	}
+
+	res := brewery.Residuals(p, pts, 0)
+	fmt.Printf("\n%8s %12s %12s %12s\n", "time", "measured", "predicted", "residual")
+	for _, r := range res {
+		fmt.Printf("%8.1f %12.1f %12.1f %12.1f\n", r.Time, r.Volume, r.Predicted, r.Residual)
+	}
+	fmt.Printf("\nrms error: %.1f ml\n", brewery.RMS(res))
+}
+
+// writeEnv appends the coefficients to an env file like
+// cmd/brewery/example.env.
+func writeEnv(p brewery.Polynomial) error {
+	if len(p) != 3 {
+		return fmt.Errorf("BREWERY_A, B and C need a degree 2 fit, use -topology for degree %d", len(p)-1)
+	}
+
+	b, err := ioutil.ReadFile(*envPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var vars []string
+	for i, k := range []string{"A", "B", "C"} {
+		vars = append(vars, fmt.Sprintf("%s_%s=%g", strings.ToUpper(*prefix), k, p[i]))
+	}
+
+	return ioutil.WriteFile(*envPath, []byte(setEnv(string(b), vars)), 0644)
+}
+
+// setEnv replaces the lines of env that export the keys of
+// vars (as in KEY=value) and appends the ones that aren't there.
+func setEnv(env string, vars []string) string {
+	var lines []string
+	if env != "" {
+		lines = strings.Split(strings.TrimRight(env, "\n"), "\n")
+	}
+
+	for _, v := range vars {
+		key := v[:strings.Index(v, "=")+1]
+		found := false
+		out := lines[:0]
+		for _, line := range lines {
+			if strings.HasPrefix(strings.TrimPrefix(strings.TrimSpace(line), "export "), key) {
+				if found {
+					continue
 				}
-			} else {
-				fmt.Println(err)
+				line = "export " + v
+				found = true
 			}
+			out = append(out, line)
+		}
+
+		lines = out
+		if !found {
+			lines = append(lines, "export "+v)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeTopology sets the flow of the transfer done by the
+// valve to the fit.
+func writeTopology(p brewery.Polynomial) error {
+	b, err := ioutil.ReadFile(*topology)
+	if err != nil {
+		return err
+	}
+
+	var top brewery.Topology
+	if err := json.Unmarshal(b, &top); err != nil {
+		return err
+	}
+
+	gadget := fmt.Sprintf("%s %s", *location, *name)
+	var found bool
+	for i, t := range top.Transfers {
+		if t.Gadget == gadget {
+			top.Transfers[i].Flow = brewery.FlowConfig{Type: "polynomial", Coefficients: p}
+			found = true
 		}
 	}
+
+	if !found {
+		return fmt.Errorf("there is no transfer for %s in %s", gadget, *topology)
+	}
+
+	b, err = json.MarshalIndent(top, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*topology, b, 0644)
 }
@@ -10,9 +10,12 @@ import (
 )
 
 var (
-	pth   = kingpin.Arg("input", "path to the recipe json file").Required().String()
+	pth   = kingpin.Arg("input", "path to the recipe (Brewtoad json, BeerXML or BeerJSON) file").Required().String()
 	temp  = kingpin.Flag("temperature", "the temperature of the grains (F)").Short('t').Float()
 	ratio = kingpin.Flag("ratio", "the grain/water ratio").Short('r').Default("1.25").Float()
+	bj    = kingpin.Flag("beerjson", "print the recipe as BeerJSON instead of its method").Short('b').Bool()
+	stats = kingpin.Flag("stats", "print the estimated og, fg, abv and ibu before the method").Short('s').Bool()
+	ibu   = kingpin.Flag("ibu", "the ibu formula, tinseth or rager").Default("tinseth").Enum("tinseth", "rager")
 )
 
 func main() {
@@ -25,11 +28,32 @@ func main() {
 
 	defer f.Close()
 
-	r, err := recipes.New(f, recipes.WaterRatio(*ratio))
+	r, err := recipes.Load(f, recipes.WaterRatio(*ratio))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *bj {
+		if err := r.WriteBeerJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *stats {
+		formula := recipes.Tinseth
+		if *ibu == "rager" {
+			formula = recipes.Rager
+		}
+
+		fmt.Printf("og: %.3f\nfg: %.3f\nabv: %.1f%%\nibu: %.1f\n", r.OG(), r.FG(), r.ABV(), r.IBU(formula))
+		for i, hopIBU := range r.HopIBUs(formula) {
+			h := r.Hops[i]
+			fmt.Printf("    %s (%.0f min): %.1f\n", h.Name, h.Time, hopIBU)
+		}
+		fmt.Println()
+	}
+
 	m := r.Method(*temp)
 	for _, row := range m {
 		fmt.Println(row)
@@ -0,0 +1,107 @@
+package brewery
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	setCmd   = regexp.MustCompile(`^set (.+) volume to ([0-9.]+) (\w+)$`)
+	addCmd   = regexp.MustCompile(`^add ([0-9.]+) (\w+) to (.+)$`)
+	emptyCmd = regexp.MustCompile(`^empty (.+)$`)
+	fillCmd  = regexp.MustCompile(`^fill (.+) to ([0-9.]+) (\w+)$`)
+	levelCmd = regexp.MustCompile(`^set (.+) level to ([0-9.]+) (\w+)$`)
+
+	heatCmd     = regexp.MustCompile(`^heat (.+) to ([0-9.]+) ([CFcf])$`)
+	stopHeatCmd = regexp.MustCompile(`^stop heating (.+)$`)
+)
+
+// volumeCommand is a manual override of the volume (or the
+// level, in cm) of a vessel, for when liquid is added or
+// removed by hand, or the target of a fill.
+type volumeCommand struct {
+	vessel string
+	add    bool
+	empty  bool
+	target bool
+	level  bool
+	ml     float64
+	cm     float64
+}
+
+// parseVolumeCommand understands:
+//
+//	set boiler volume to 3.5 gallons
+//	add 1 gallon to tun
+//	empty carboy
+//	fill tun to 3.2 gallons
+//	set tun level to 20 cm
+func parseVolumeCommand(body string) (*volumeCommand, bool, error) {
+	if m := levelCmd.FindStringSubmatch(body); m != nil {
+		cm, err := parseLength(m[2], m[3])
+		return &volumeCommand{vessel: m[1], level: true, cm: cm}, true, err
+	}
+
+	if m := setCmd.FindStringSubmatch(body); m != nil {
+		ml, err := parseVolume(m[2], m[3])
+		return &volumeCommand{vessel: m[1], ml: ml}, true, err
+	}
+
+	if m := addCmd.FindStringSubmatch(body); m != nil {
+		ml, err := parseVolume(m[1], m[2])
+		return &volumeCommand{vessel: m[3], add: true, ml: ml}, true, err
+	}
+
+	if m := emptyCmd.FindStringSubmatch(body); m != nil {
+		return &volumeCommand{vessel: m[1], empty: true}, true, nil
+	}
+
+	if m := fillCmd.FindStringSubmatch(body); m != nil {
+		ml, err := parseVolume(m[2], m[3])
+		return &volumeCommand{vessel: m[1], target: true, ml: ml}, true, err
+	}
+
+	return nil, false, nil
+}
+
+func parseLength(val, units string) (float64, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+	return toCM(f, units)
+}
+
+func parseVolume(val, units string) (float64, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+	return toML(f, units)
+}
+
+// heatCommand is the target temperature (C) of a heater, a
+// nil target means the heater was turned off.
+type heatCommand struct {
+	vessel string
+	target *float64
+}
+
+// parseHeatCommand understands the commands of the heater
+// gadgets:
+//
+//	heat hlt to 170 F
+//	stop heating hlt
+func parseHeatCommand(body string) (*heatCommand, bool, error) {
+	if m := heatCmd.FindStringSubmatch(body); m != nil {
+		f, err := strconv.ParseFloat(m[2], 64)
+		c := toCelsius(f, m[3])
+		return &heatCommand{vessel: m[1], target: &c}, true, err
+	}
+
+	if m := stopHeatCmd.FindStringSubmatch(body); m != nil {
+		return &heatCommand{vessel: m[1]}, true, nil
+	}
+
+	return nil, false, nil
+}
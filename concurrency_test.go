@@ -0,0 +1,106 @@
+package brewery_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Concurrency", func() {
+	var (
+		lock    sync.Mutex
+		volumes map[string]float64
+		inputs  map[string]chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		volumes = map[string]float64{}
+		inputs = map[string]chan gogadgets.Message{}
+
+		cfg := &brewery.Config{
+			Units: "ml",
+			Vessels: []brewery.Vessel{
+				{Name: "hlt"},
+				{Name: "tun"},
+				{Name: "boiler"},
+			},
+			Transfers: []brewery.Transfer{
+				{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 100000.0}},
+				{From: "tun", To: "boiler", Gadget: "boiler valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 50000.0}},
+			},
+		}
+
+		fast := func(d time.Duration) <-chan time.Time {
+			return time.After(time.Millisecond)
+		}
+
+		b, err := brewery.New(cfg, brewery.WithAfter(fast))
+		Expect(err).To(BeNil())
+
+		for _, name := range []string{"hlt", "tun", "boiler"} {
+			in := make(chan gogadgets.Message)
+			out := make(chan gogadgets.Message)
+			inputs[name] = in
+			go b.Tank(name).Start(in, out)
+			go func() {
+				for msg := range out {
+					if msg.Type == "update" && msg.Name == "volume" {
+						lock.Lock()
+						volumes[msg.Location] = msg.Value.Value.(float64)
+						lock.Unlock()
+					}
+				}
+			}()
+		}
+	})
+
+	total := func() float64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return volumes["hlt"] + volumes["tun"] + volumes["boiler"]
+	}
+
+	valve := func(sender string, on bool) {
+		inputs["hlt"] <- gogadgets.Message{
+			Type:   "update",
+			Sender: sender,
+			Value: gogadgets.Value{
+				Value: on,
+			},
+		}
+	}
+
+	It("conserves volume while valves open and close concurrently", func() {
+		inputs["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 20000 ml"}
+
+		var wg sync.WaitGroup
+		for _, sender := range []string{"tun valve", "boiler valve", "tun valve", "boiler valve"} {
+			wg.Add(1)
+			go func(sender string) {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					valve(sender, i%2 == 0)
+					time.Sleep(time.Millisecond)
+				}
+			}(sender)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				inputs["tun"] <- gogadgets.Message{Type: "command", Body: "add 100 ml to tun"}
+			}
+		}()
+
+		wg.Wait()
+		valve("tun valve", false)
+		valve("boiler valve", false)
+
+		Eventually(total).Should(BeNumerically("~", 21000.0, 1e-6))
+	})
+})
@@ -0,0 +1,183 @@
+package brewery
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	//gravity in cm/s^2, the flow models work in cm and ml.
+	gravity = 980.665
+)
+
+// FlowModel estimates the volume (ml) that has moved through
+// a transfer that has been open for elapsed.  start is the
+// volume (ml) that was in the source vessel when the transfer
+// began.
+type FlowModel interface {
+	Volume(elapsed time.Duration, start float64) float64
+}
+
+// FlowConfig declares the FlowModel of a transfer.  Type is one
+// of "polynomial", "torricelli", "pump", "table" or "timed", and
+// only the fields for that type need to be set.
+type FlowConfig struct {
+	Type string `json:"type"`
+
+	//Coefficients of a polynomial, lowest order first, where
+	//x = time (s) and y = vol (ml).
+	Coefficients []float64 `json:"coefficients,omitempty"`
+
+	//TankRadius and ValveRadius (cm) and the discharge
+	//Coefficient of a gravity drain.
+	TankRadius  float64 `json:"tank_radius,omitempty"`
+	ValveRadius float64 `json:"valve_radius,omitempty"`
+	Coefficient float64 `json:"coefficient,omitempty"`
+
+	//Rate of a pump in ml/s.
+	Rate float64 `json:"rate,omitempty"`
+
+	//Table of measured volumes.
+	Table []FlowPoint `json:"table,omitempty"`
+
+	//Time (s) after which a timed transfer has moved
+	//everything.
+	Time int `json:"time,omitempty"`
+}
+
+func newFlowModel(cfg FlowConfig) (FlowModel, error) {
+	switch cfg.Type {
+	case "polynomial":
+		return Polynomial(cfg.Coefficients), nil
+	case "torricelli":
+		if cfg.TankRadius <= 0 || cfg.ValveRadius <= 0 || cfg.Coefficient <= 0 {
+			return nil, fmt.Errorf("torricelli flow needs a tank radius, valve radius and coefficient")
+		}
+		return &Torricelli{TankRadius: cfg.TankRadius, ValveRadius: cfg.ValveRadius, Coefficient: cfg.Coefficient}, nil
+	case "pump":
+		return Pump(cfg.Rate), nil
+	case "table":
+		return NewTable(cfg.Table)
+	case "timed":
+		return Timed(time.Duration(cfg.Time) * time.Second), nil
+	}
+	return nil, fmt.Errorf("unknown flow type %q", cfg.Type)
+}
+
+// Polynomial is a curve fit of volume (ml) against time (s),
+// as in y = c[0] + c[1]x + c[2]x^2...
+type Polynomial []float64
+
+// zero is true when the polynomial never moves anything.
+func (p Polynomial) zero() bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Polynomial) Volume(elapsed time.Duration, start float64) float64 {
+	x := elapsed.Seconds()
+	var y, pow float64 = 0, 1
+	for _, c := range p {
+		y += c * pow
+		pow *= x
+	}
+	return y
+}
+
+// Torricelli is liquid draining by gravity out of a cylindrical
+// tank through a valve at the bottom.  The level in the tank,
+// and so the flow rate, drops as it drains.
+type Torricelli struct {
+	//TankRadius and ValveRadius are in cm.
+	TankRadius  float64
+	ValveRadius float64
+
+	//Coefficient is the discharge coefficient of the valve,
+	//which accounts for friction and the contraction of the
+	//stream.
+	Coefficient float64
+}
+
+func (t *Torricelli) Volume(elapsed time.Duration, start float64) float64 {
+	area := math.Pi * t.TankRadius * t.TankRadius
+	ratio := (t.ValveRadius * t.ValveRadius) / (t.TankRadius * t.TankRadius)
+
+	//sqrt(h) falls linearly with time, from sqrt(h0)
+	k := t.Coefficient * ratio * math.Sqrt(gravity/2)
+	s := math.Sqrt(start/area) - k*elapsed.Seconds()
+	if s <= 0 {
+		return start
+	}
+	return start - area*s*s
+}
+
+// Pump moves liquid at a constant rate (ml/s).
+type Pump float64
+
+func (p Pump) Volume(elapsed time.Duration, start float64) float64 {
+	return float64(p) * elapsed.Seconds()
+}
+
+// Timed transfers have an unknown rate, so after waiting a safe
+// amount of time everything is assumed to have moved.
+type Timed time.Duration
+
+func (t Timed) Volume(elapsed time.Duration, start float64) float64 {
+	if elapsed < time.Duration(t) {
+		return 0
+	}
+	return start
+}
+
+// FlowPoint is a measured volume (ml) after a transfer had been
+// open for Time (s).
+type FlowPoint struct {
+	Time   float64 `json:"time"`
+	Volume float64 `json:"volume"`
+}
+
+// Table interpolates between measured points.  Past the last
+// point the last segment is extrapolated.
+type Table []FlowPoint
+
+func NewTable(pts []FlowPoint) (Table, error) {
+	if len(pts) == 0 {
+		return nil, fmt.Errorf("table flow needs at least one point")
+	}
+
+	t := make(Table, len(pts))
+	copy(t, pts)
+	sort.Slice(t, func(i, j int) bool { return t[i].Time < t[j].Time })
+	if t[0].Time != 0 {
+		t = append(Table{{}}, t...)
+	}
+	return t, nil
+}
+
+func (t Table) Volume(elapsed time.Duration, start float64) float64 {
+	x := elapsed.Seconds()
+	if len(t) == 1 {
+		return t[0].Volume
+	}
+
+	i := sort.Search(len(t), func(i int) bool { return t[i].Time >= x })
+	if i == 0 {
+		return t[0].Volume
+	}
+
+	if i == len(t) {
+		i = len(t) - 1
+	}
+
+	a, b := t[i-1], t[i]
+	if b.Time == a.Time {
+		return b.Volume
+	}
+	return a.Volume + (x-a.Time)*(b.Volume-a.Volume)/(b.Time-a.Time)
+}
@@ -0,0 +1,55 @@
+package brewery_test
+
+import (
+	"time"
+
+	"github.com/cswank/brewery"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flow models", func() {
+	It("evaluates a polynomial", func() {
+		p := brewery.Polynomial{1.0, 2.0, 3.0}
+		Expect(p.Volume(2*time.Second, 0)).To(Equal(17.0))
+	})
+
+	It("won't use a polynomial without coefficients", func() {
+		cfg := &brewery.Config{
+			Vessels:   []brewery.Vessel{{Name: "hlt"}, {Name: "tun"}},
+			Transfers: []brewery.Transfer{{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "polynomial", Coefficients: []float64{0, 0, 0}}}},
+		}
+		_, err := brewery.New(cfg)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("drains a tank by gravity", func() {
+		t := &brewery.Torricelli{TankRadius: 10.0, ValveRadius: 0.25, Coefficient: 0.4}
+		first := t.Volume(10*time.Second, 10000.0)
+		second := t.Volume(20*time.Second, 10000.0) - first
+		Expect(first).To(BeNumerically(">", 0.0))
+		Expect(second).To(BeNumerically("<", first))
+		Expect(t.Volume(time.Hour, 10000.0)).To(Equal(10000.0))
+	})
+
+	It("pumps at a constant rate", func() {
+		Expect(brewery.Pump(25.0).Volume(4*time.Second, 0)).To(Equal(100.0))
+	})
+
+	It("waits before a timed transfer is done", func() {
+		t := brewery.Timed(5 * time.Minute)
+		Expect(t.Volume(time.Minute, 1000.0)).To(Equal(0.0))
+		Expect(t.Volume(5*time.Minute, 1000.0)).To(Equal(1000.0))
+	})
+
+	It("interpolates a table", func() {
+		t, err := brewery.NewTable([]brewery.FlowPoint{
+			{Time: 20, Volume: 300},
+			{Time: 10, Volume: 100},
+		})
+		Expect(err).To(BeNil())
+		Expect(t.Volume(5*time.Second, 0)).To(Equal(50.0))
+		Expect(t.Volume(15*time.Second, 0)).To(Equal(200.0))
+		Expect(t.Volume(30*time.Second, 0)).To(Equal(500.0))
+	})
+})
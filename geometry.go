@@ -0,0 +1,129 @@
+package brewery
+
+import (
+	"fmt"
+	"math"
+)
+
+// Geometry is the inside of a vessel, lengths are cm (so
+// volumes are cm^3, which is ml).  It is a cylinder that
+// either sits on a Shape bottom or, for a vessel with a false
+// bottom, on DeadSpace ml of liquid below FalseBottom.
+type Geometry struct {
+	Radius float64 `json:"radius"`
+
+	//Shape is the bottom of the vessel: "flat" (the default),
+	//"dished" (a spherical cap) or "conical", and Bottom is
+	//how deep a dished or conical bottom is.
+	Shape  string  `json:"shape,omitempty"`
+	Bottom float64 `json:"bottom,omitempty"`
+
+	//FalseBottom is the height of the false bottom and
+	//DeadSpace the volume beneath it, which can't be drained.
+	FalseBottom float64 `json:"false_bottom,omitempty"`
+	DeadSpace   float64 `json:"dead_space,omitempty"`
+
+	//Height is the inside height of the vessel and MaxVolume
+	//(ml) the most it should be filled to, which is the
+	//volume at Height by default.
+	Height    float64 `json:"height,omitempty"`
+	MaxVolume float64 `json:"max_volume,omitempty"`
+}
+
+func (g Geometry) validate() error {
+	if g.Radius <= 0 {
+		return fmt.Errorf("the radius must be greater than 0")
+	}
+
+	switch g.Shape {
+	case "", "flat":
+	case "dished", "conical":
+		if g.Bottom <= 0 {
+			return fmt.Errorf("a %s bottom needs its depth", g.Shape)
+		}
+	default:
+		return fmt.Errorf("unknown shape %q", g.Shape)
+	}
+	return nil
+}
+
+// Volume (ml) when the liquid is level cm deep.
+func (g Geometry) Volume(level float64) float64 {
+	if level <= 0 {
+		return 0
+	}
+
+	area := math.Pi * g.Radius * g.Radius
+	switch {
+	case g.FalseBottom > 0:
+		if level < g.FalseBottom {
+			return g.DeadSpace * level / g.FalseBottom
+		}
+		return g.DeadSpace + area*(level-g.FalseBottom)
+	case g.Shape == "dished" || g.Shape == "conical":
+		if level < g.Bottom {
+			return g.bottom(level)
+		}
+		return g.bottom(g.Bottom) + area*(level-g.Bottom)
+	default:
+		return area * level
+	}
+}
+
+// bottom is the volume of the first level cm of a dished or
+// conical bottom.
+func (g Geometry) bottom(level float64) float64 {
+	if g.Shape == "conical" {
+		r := g.Radius * level / g.Bottom
+		return math.Pi * r * r * level / 3
+	}
+
+	//the sphere that makes a dish that is Bottom deep and
+	//Radius wide.
+	r := (g.Radius*g.Radius + g.Bottom*g.Bottom) / (2 * g.Bottom)
+	return math.Pi * level * level * (3*r - level) / 3
+}
+
+// Level (cm) of ml of liquid, for sight glass style displays.
+func (g Geometry) Level(ml float64) float64 {
+	if ml <= 0 || g.Radius <= 0 {
+		return 0
+	}
+
+	//Volume only ever grows with the level, so bisect.
+	lo, hi := 0.0, 1.0
+	for g.Volume(hi) < ml {
+		hi *= 2
+	}
+
+	for i := 0; i < 100 && hi-lo > 1e-9; i++ {
+		mid := (lo + hi) / 2
+		if g.Volume(mid) < ml {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// Total (ml) is the volume of the whole vessel, 0 if its
+// Height isn't known.
+func (g Geometry) Total() float64 {
+	return g.Volume(g.Height)
+}
+
+// Max (ml) is the most the vessel should be filled to, 0 if
+// it isn't known.
+func (g Geometry) Max() float64 {
+	if g.MaxVolume > 0 {
+		return g.MaxVolume
+	}
+	return g.Total()
+}
+
+// Usable (ml) is how much of ml can be drained, everything
+// but the dead space.
+func (g Geometry) Usable(ml float64) float64 {
+	return math.Max(0, ml-g.DeadSpace)
+}
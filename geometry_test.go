@@ -0,0 +1,151 @@
+package brewery_test
+
+import (
+	"math"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Geometry", func() {
+	It("is a cylinder", func() {
+		g := brewery.Geometry{Radius: 10, Height: 30}
+		Expect(g.Volume(10)).To(BeNumerically("~", math.Pi*1000, 1e-9))
+		Expect(g.Level(math.Pi * 1000)).To(BeNumerically("~", 10, 1e-6))
+		Expect(g.Volume(-1)).To(Equal(0.0))
+		Expect(g.Total()).To(BeNumerically("~", math.Pi*3000, 1e-9))
+		Expect(g.Max()).To(Equal(g.Total()))
+	})
+
+	It("has a dished bottom", func() {
+		g := brewery.Geometry{Radius: 10, Shape: "dished", Bottom: 10}
+		Expect(g.Volume(10)).To(BeNumerically("~", 2.0/3.0*math.Pi*1000, 1e-9))
+		Expect(g.Volume(20)).To(BeNumerically("~", 2.0/3.0*math.Pi*1000+math.Pi*1000, 1e-9))
+		Expect(g.Level(g.Volume(4))).To(BeNumerically("~", 4, 1e-6))
+	})
+
+	It("has a conical bottom", func() {
+		g := brewery.Geometry{Radius: 10, Shape: "conical", Bottom: 15}
+		Expect(g.Volume(15)).To(BeNumerically("~", math.Pi*100*15/3, 1e-9))
+		Expect(g.Volume(25)).To(BeNumerically("~", math.Pi*100*15/3+math.Pi*1000, 1e-9))
+		Expect(g.Level(g.Volume(5))).To(BeNumerically("~", 5, 1e-6))
+	})
+
+	It("has dead space under a false bottom", func() {
+		g := brewery.Geometry{Radius: 10, FalseBottom: 5, DeadSpace: 2000, MaxVolume: 10000}
+		Expect(g.Volume(2.5)).To(Equal(1000.0))
+		Expect(g.Volume(15)).To(BeNumerically("~", 2000+math.Pi*1000, 1e-9))
+		Expect(g.Level(2000 + math.Pi*1000)).To(BeNumerically("~", 15, 1e-6))
+		Expect(g.Usable(1500)).To(Equal(0.0))
+		Expect(g.Usable(5000)).To(Equal(3000.0))
+		Expect(g.Max()).To(Equal(10000.0))
+	})
+
+	Context("tank", func() {
+		var (
+			in  map[string]chan gogadgets.Message
+			out map[string]chan gogadgets.Message
+			g   *brewery.Geometry
+		)
+
+		BeforeEach(func() {
+			g = &brewery.Geometry{Radius: 10, FalseBottom: 5, DeadSpace: 2000, MaxVolume: 10000}
+			cfg := &brewery.Config{
+				Units: "liters",
+				Vessels: []brewery.Vessel{
+					{Name: "hlt"},
+					{Name: "tun", Geometry: g},
+				},
+				Transfers: []brewery.Transfer{
+					{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 100}},
+					{To: "tun", Gadget: "tun mains"},
+				},
+			}
+
+			b, err := brewery.New(cfg)
+			Expect(err).To(BeNil())
+
+			in = map[string]chan gogadgets.Message{}
+			out = map[string]chan gogadgets.Message{}
+			for _, name := range []string{"hlt", "tun"} {
+				in[name] = make(chan gogadgets.Message, 100)
+				out[name] = make(chan gogadgets.Message)
+				go b.Tank(name).Start(out[name], in[name])
+				<-in[name]
+			}
+			<-in["tun"]
+			<-in["tun"]
+		})
+
+		It("publishes the usable volume and the level", func() {
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "set tun level to 15 cm"}
+			msg := <-in["tun"]
+			Expect(msg.Name).To(Equal("volume"))
+			Expect(msg.Value.Value.(float64)).To(BeNumerically("~", (2000+math.Pi*1000)/1000, 1e-9))
+
+			msg = <-in["tun"]
+			Expect(msg.Name).To(Equal("usable volume"))
+			Expect(msg.Value.Value.(float64)).To(BeNumerically("~", math.Pi, 1e-9))
+
+			msg = <-in["tun"]
+			Expect(msg.Name).To(Equal("level"))
+			Expect(msg.Value.Units).To(Equal("cm"))
+			Expect(msg.Value.Value.(float64)).To(BeNumerically("~", 15, 1e-6))
+		})
+
+		It("stops a transfer that would overflow the tun", func() {
+			out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 20 liters"}
+			<-in["hlt"]
+
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: true}}
+			msg := <-in["hlt"]
+			Expect(msg.Type).To(Equal("command"))
+			Expect(msg.Body).To(Equal("stop filling tun"))
+		})
+
+		It("rejects a target past the max volume", func() {
+			out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 20 liters"}
+			<-in["hlt"]
+
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "fill tun to 12 liters"}
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: true}}
+			msg := <-in["hlt"]
+			Expect(msg.Body).To(Equal("stop filling tun"))
+		})
+
+		It("lets a transfer with a target inside the max volume run", func() {
+			out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 20 liters"}
+			<-in["hlt"]
+
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "fill tun to 8 liters"}
+			//the tun has set the target once it has answered
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "update"}
+			<-in["tun"]
+
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: true}}
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: false}}
+			msg := <-in["hlt"]
+			Expect(msg.Type).To(Equal("update"))
+			Expect(msg.Name).To(Equal("volume"))
+		})
+
+		It("forgets the target of a fill from the mains once it stops", func() {
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "fill tun to 8 liters"}
+			out["tun"] <- gogadgets.Message{Type: "command", Body: "update"}
+			<-in["tun"]
+
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun mains", Value: gogadgets.Value{Value: true}}
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun mains", Value: gogadgets.Value{Value: false}}
+
+			out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 20 liters"}
+			<-in["hlt"]
+
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: true}}
+			msg := <-in["hlt"]
+			Expect(msg.Type).To(Equal("command"))
+			Expect(msg.Body).To(Equal("stop filling tun"))
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package brewery
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// CalibrationRecord is a fill that ended with the vessel
+// being measured (by a level switch or a manual "set"), so
+// the flow model's prediction can be compared with what
+// actually moved.
+type CalibrationRecord struct {
+	Time   time.Time `json:"time"`
+	Gadget string    `json:"gadget"`
+	Vessel string    `json:"vessel"`
+
+	//Flow is the type of the gadget's flow model (see
+	//FlowConfig.Type).
+	Flow string `json:"flow,omitempty"`
+
+	//Elapsed (s) is how long the gadget was on, and Predicted
+	//and Actual are the ml it moved.
+	Elapsed   float64 `json:"elapsed"`
+	Predicted float64 `json:"predicted"`
+	Actual    float64 `json:"actual"`
+}
+
+// Error is how far off the prediction was, as a fraction of
+// what actually moved.  A prediction of anything when nothing
+// moved is infinitely off.
+func (c CalibrationRecord) Error() float64 {
+	if c.Actual == 0 && c.Predicted == 0 {
+		return 0
+	}
+	return (c.Predicted - c.Actual) / c.Actual
+}
+
+// jsonLog appends a json line for every record, it is used
+// for the calibration and interlock logs.
+type jsonLog struct {
+	path string
+}
+
+func newJSONLog(path string) *jsonLog {
+	if path == "" {
+		return nil
+	}
+	return &jsonLog{path: path}
+}
+
+func (j *jsonLog) add(rec interface{}) error {
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(rec); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadCalibrationLog reads the records written to
+// Config.CalibrationLog.
+func ReadCalibrationLog(r io.Reader) ([]CalibrationRecord, error) {
+	var out []CalibrationRecord
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var rec CalibrationRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, s.Err()
+}
+
+// Drift is how the predictions for one gadget have held up
+// over time.
+type Drift struct {
+	Gadget  string
+	Flow    string
+	Records []CalibrationRecord
+
+	//Error is the mean error (see CalibrationRecord.Error) of
+	//the most recent records.  When its magnitude is over the
+	//threshold and the gadget has a polynomial flow Refit is a
+	//new fit of those records.
+	Error float64
+	Refit Polynomial
+}
+
+// NewDrift groups the records by gadget (in time order) and
+// works out the mean error of the last recent records of each.
+func NewDrift(records []CalibrationRecord, recent int, threshold float64) []Drift {
+	gadgets := map[string][]CalibrationRecord{}
+	for _, r := range records {
+		gadgets[r.Gadget] = append(gadgets[r.Gadget], r)
+	}
+
+	var out []Drift
+	for g, recs := range gadgets {
+		sort.Slice(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+		d := Drift{Gadget: g, Flow: recs[len(recs)-1].Flow, Records: recs}
+
+		last := recs
+		if recent > 0 && len(last) > recent {
+			last = last[len(last)-recent:]
+		}
+
+		for _, r := range last {
+			d.Error += r.Error()
+		}
+		d.Error /= float64(len(last))
+
+		if math.Abs(d.Error) > threshold && d.Flow == "polynomial" {
+			pts := make([]FlowPoint, len(last))
+			for i, r := range last {
+				pts[i] = FlowPoint{Time: r.Elapsed, Volume: r.Actual}
+			}
+			//not enough different fills for a fit leaves Refit nil
+			d.Refit, _ = FitPolynomial(pts, 2)
+		}
+		out = append(out, d)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Gadget < out[j].Gadget })
+	return out
+}
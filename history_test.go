@@ -0,0 +1,193 @@
+package brewery_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Calibration history", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "brewery")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("logs a fill that ends with the vessel being measured", func() {
+		pth := filepath.Join(dir, "calibration.log")
+		afterTrigger := make(chan bool)
+		cfg := &brewery.Config{
+			Units:          "ml",
+			CalibrationLog: pth,
+			Vessels:        []brewery.Vessel{{Name: "hlt"}, {Name: "tun"}},
+			Transfers: []brewery.Transfer{
+				{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 100.0}},
+			},
+		}
+
+		b, err := brewery.New(cfg, brewery.WithAfter((&FakeAfter{trigger: afterTrigger}).After), brewery.WithTimer(&fakeTimer{}))
+		Expect(err).To(BeNil())
+
+		in := map[string]chan gogadgets.Message{}
+		out := map[string]chan gogadgets.Message{}
+		for _, name := range []string{"hlt", "tun"} {
+			in[name] = make(chan gogadgets.Message, 100)
+			out[name] = make(chan gogadgets.Message)
+			go b.Tank(name).Start(out[name], in[name])
+		}
+
+		out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 5000 ml"}
+		valve := func(on bool) {
+			out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: on}}
+		}
+
+		//moved waits for the tun to publish what was moved
+		moved := func(ml float64) {
+			for msg := range in["tun"] {
+				if msg.Name == "volume" && msg.Value.Value.(float64) == ml {
+					return
+				}
+			}
+		}
+
+		valve(true)
+		afterTrigger <- true
+		moved(100)
+		afterTrigger <- true
+		moved(200)
+		valve(false)
+		moved(300)
+
+		out["tun"] <- gogadgets.Message{Type: "command", Body: "set tun volume to 350 ml"}
+
+		var records []brewery.CalibrationRecord
+		Eventually(func() int {
+			f, err := os.Open(pth)
+			if err != nil {
+				return 0
+			}
+			defer f.Close()
+			records, err = brewery.ReadCalibrationLog(f)
+			Expect(err).To(BeNil())
+			return len(records)
+		}).Should(Equal(1))
+
+		r := records[0]
+		Expect(r.Gadget).To(Equal("tun valve"))
+		Expect(r.Vessel).To(Equal("tun"))
+		Expect(r.Flow).To(Equal("pump"))
+		Expect(r.Elapsed).To(Equal(3.0))
+		Expect(r.Predicted).To(Equal(300.0))
+		Expect(r.Actual).To(Equal(350.0))
+		Expect(r.Error()).To(BeNumerically("~", -50.0/350.0, 1e-9))
+	})
+
+	It("doesn't log a fill that ends with the vessel being emptied", func() {
+		pth := filepath.Join(dir, "calibration.log")
+		afterTrigger := make(chan bool)
+		cfg := &brewery.Config{
+			Units:          "ml",
+			CalibrationLog: pth,
+			Vessels:        []brewery.Vessel{{Name: "hlt"}, {Name: "tun"}},
+			Transfers: []brewery.Transfer{
+				{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 100.0}},
+			},
+		}
+
+		b, err := brewery.New(cfg, brewery.WithAfter((&FakeAfter{trigger: afterTrigger}).After), brewery.WithTimer(&fakeTimer{}))
+		Expect(err).To(BeNil())
+
+		in := map[string]chan gogadgets.Message{}
+		out := map[string]chan gogadgets.Message{}
+		for _, name := range []string{"hlt", "tun"} {
+			in[name] = make(chan gogadgets.Message, 100)
+			out[name] = make(chan gogadgets.Message)
+			go b.Tank(name).Start(out[name], in[name])
+		}
+
+		out["hlt"] <- gogadgets.Message{Type: "command", Body: "set hlt volume to 5000 ml"}
+		out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: true}}
+		afterTrigger <- true
+		out["hlt"] <- gogadgets.Message{Type: "update", Sender: "tun valve", Value: gogadgets.Value{Value: false}}
+
+		out["tun"] <- gogadgets.Message{Type: "command", Body: "empty tun"}
+		out["tun"] <- gogadgets.Message{Type: "command", Body: "set tun volume to 350 ml"}
+		for msg := range in["tun"] {
+			if msg.Name == "volume" && msg.Value.Value.(float64) == 350 {
+				break
+			}
+		}
+
+		_, err = os.Stat(pth)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("suggests a refit when the predictions drift", func() {
+		start := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+		var records []brewery.CalibrationRecord
+		for i, elapsed := range []float64{30, 60, 90, 30, 60, 90} {
+			actual := 100*elapsed - 0.2*elapsed*elapsed
+			if i >= 3 {
+				//the valve is clogging
+				actual *= 0.8
+			}
+			records = append(records, brewery.CalibrationRecord{
+				Time:      start.Add(time.Duration(i) * 24 * time.Hour),
+				Gadget:    "tun valve",
+				Vessel:    "tun",
+				Flow:      "polynomial",
+				Elapsed:   elapsed,
+				Predicted: 100*elapsed - 0.2*elapsed*elapsed,
+				Actual:    actual,
+			})
+		}
+
+		drift := brewery.NewDrift(records, 3, 0.05)
+		Expect(drift).To(HaveLen(1))
+		Expect(drift[0].Records).To(HaveLen(6))
+		Expect(drift[0].Error).To(BeNumerically("~", 0.25, 1e-9))
+		Expect(drift[0].Refit).To(HaveLen(3))
+		Expect(drift[0].Refit[1]).To(BeNumerically("~", 80, 1e-6))
+
+		drift = brewery.NewDrift(records[:3], 3, 0.05)
+		Expect(drift[0].Error).To(BeNumerically("~", 0, 1e-9))
+		Expect(drift[0].Refit).To(BeNil())
+
+		//only a polynomial can be refit from the fills
+		for i := range records {
+			records[i].Flow = "pump"
+		}
+		drift = brewery.NewDrift(records, 3, 0.05)
+		Expect(drift[0].Error).To(BeNumerically("~", 0.25, 1e-9))
+		Expect(drift[0].Refit).To(BeNil())
+	})
+
+	It("counts a fill that moved nothing as infinitely off", func() {
+		Expect(brewery.CalibrationRecord{Predicted: 300}.Error()).To(BeNumerically(">", 1e300))
+		Expect(brewery.CalibrationRecord{}.Error()).To(Equal(0.0))
+	})
+
+	It("reads the log", func() {
+		r := strings.NewReader(`{"gadget": "tun valve", "elapsed": 30, "predicted": 100, "actual": 110}
+
+{"gadget": "boiler valve", "elapsed": 300, "predicted": 10000, "actual": 9000}
+`)
+		records, err := brewery.ReadCalibrationLog(r)
+		Expect(err).To(BeNil())
+		Expect(records).To(HaveLen(2))
+		Expect(records[1].Gadget).To(Equal("boiler valve"))
+	})
+})
@@ -0,0 +1,168 @@
+package brewery
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cswank/gogadgets"
+)
+
+// Trip is a record of the interlock turning a gadget off.
+type Trip struct {
+	Time   time.Time `json:"time"`
+	Vessel string    `json:"vessel"`
+	Gadget string    `json:"gadget"`
+	Reason string    `json:"reason"`
+	Volume float64   `json:"volume"`
+}
+
+// Interlock is a gadget that keeps heaters from firing with
+// too little liquid in their vessel and transfers from
+// overfilling theirs.  It watches the volumes published by
+// the tanks and the updates of the heaters and transfer
+// gadgets, and sends their off command when they are on when
+// they shouldn't be.
+type Interlock struct {
+	vessels map[string]*interlockVessel
+	gadgets map[string]*interlockGadget
+	log     *jsonLog
+	out     chan<- gogadgets.Message
+}
+
+type interlockVessel struct {
+	name   string
+	volume float64
+
+	//max (ml) is the most the vessel can hold and min (ml)
+	//is the least that its heater can fire with.
+	max float64
+	min float64
+}
+
+type interlockGadget struct {
+	vessel  *interlockVessel
+	heater  bool
+	stop    string
+	on      bool
+	tripped bool
+}
+
+func newInterlock(cfg *Config, top *Topology) *Interlock {
+	i := &Interlock{
+		vessels: map[string]*interlockVessel{},
+		gadgets: map[string]*interlockGadget{},
+		log:     newJSONLog(cfg.InterlockLog),
+	}
+
+	for _, v := range top.Vessels {
+		iv := &interlockVessel{name: v.Name, max: v.Capacity * gallonsToML}
+		if v.Geometry != nil && v.Geometry.Max() > 0 {
+			iv.max = v.Geometry.Max()
+		}
+
+		if v.Heater != "" {
+			iv.min = v.HeaterVolume * gallonsToML
+			i.gadgets[v.Heater] = &interlockGadget{vessel: iv, heater: true, stop: fmt.Sprintf("stop heating %s", v.Name)}
+		}
+		i.vessels[v.Name] = iv
+	}
+
+	for _, t := range top.Transfers {
+		stop := t.Stop
+		if stop == "" {
+			stop = fmt.Sprintf("stop filling %s", t.To)
+		}
+		i.gadgets[t.Gadget] = &interlockGadget{vessel: i.vessels[t.To], stop: stop}
+	}
+
+	return i
+}
+
+func (i *Interlock) GetUID() string {
+	return "interlock"
+}
+
+func (i *Interlock) GetDirection() string {
+	return "input"
+}
+
+func (i *Interlock) Start(input <-chan gogadgets.Message, out chan<- gogadgets.Message) {
+	i.out = out
+	for msg := range input {
+		i.readMessage(msg)
+	}
+}
+
+func (i *Interlock) readMessage(msg gogadgets.Message) {
+	if msg.Type != "update" {
+		return
+	}
+
+	if v, ok := i.vessels[msg.Location]; ok && msg.Name == "volume" {
+		val, ok := msg.Value.Value.(float64)
+		if !ok {
+			return
+		}
+
+		ml, err := toML(val, msg.Value.Units)
+		if err != nil {
+			log.Printf("interlock: invalid volume from %s: %s", msg.Sender, err)
+			return
+		}
+		v.volume = ml
+		i.check()
+		return
+	}
+
+	if g, ok := i.gadgets[msg.Sender]; ok {
+		on, ok := msg.Value.Value.(bool)
+		if !ok {
+			return
+		}
+
+		g.on = on
+		if !on {
+			g.tripped = false
+		}
+		i.check()
+	}
+}
+
+// check trips every gadget that is on when it shouldn't be.
+// A gadget is only tripped once each time it is turned on.
+func (i *Interlock) check() {
+	for name, g := range i.gadgets {
+		if !g.on || g.tripped {
+			continue
+		}
+
+		v := g.vessel
+		switch {
+		case g.heater && v.volume < v.min:
+			i.trip(name, g, fmt.Sprintf("%.0f ml is below the minimum of %.0f ml for the heater", v.volume, v.min))
+		case !g.heater && v.max > 0 && v.volume >= v.max:
+			i.trip(name, g, fmt.Sprintf("%.0f ml is at the capacity of %.0f ml", v.volume, v.max))
+		}
+	}
+}
+
+func (i *Interlock) trip(name string, g *interlockGadget, reason string) {
+	g.tripped = true
+	log.Printf("interlock tripped %s in %s: %s", name, g.vessel.name, reason)
+
+	if i.log != nil {
+		t := Trip{Time: time.Now(), Vessel: g.vessel.name, Gadget: name, Reason: reason, Volume: g.vessel.volume}
+		if err := i.log.add(t); err != nil {
+			log.Println("unable to add to the interlock log", err)
+		}
+	}
+
+	i.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    i.GetUID(),
+		Type:      "command",
+		Body:      g.stop,
+		Timestamp: time.Now().UTC(),
+	}
+}
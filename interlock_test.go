@@ -0,0 +1,101 @@
+package brewery_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interlock", func() {
+	var (
+		dir     string
+		in, out chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "brewery")
+		Expect(err).To(BeNil())
+
+		cfg := &brewery.Config{
+			InterlockLog: filepath.Join(dir, "interlock.log"),
+			Vessels: []brewery.Vessel{
+				{Name: "hlt", Capacity: 7.0},
+				{Name: "boiler", Heater: "boiler heater", HeaterVolume: 1.0},
+			},
+			Transfers: []brewery.Transfer{
+				{To: "hlt", Gadget: "hlt valve"},
+				{From: "hlt", To: "boiler", Gadget: "boiler valve", Flow: brewery.FlowConfig{Type: "timed"}},
+			},
+		}
+
+		b, err := brewery.New(cfg)
+		Expect(err).To(BeNil())
+
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+		go b.Interlock().Start(in, out)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	volume := func(vessel string, gallons float64) {
+		in <- gogadgets.Message{
+			Type:     "update",
+			Sender:   vessel + " volume",
+			Location: vessel,
+			Name:     "volume",
+			Value:    gogadgets.Value{Value: gallons, Units: "gallons"},
+		}
+	}
+
+	gadget := func(sender string, on bool) {
+		in <- gogadgets.Message{Type: "update", Sender: sender, Value: gogadgets.Value{Value: on}}
+	}
+
+	It("won't let the boiler heater dry fire", func() {
+		volume("boiler", 0.5)
+		gadget("boiler heater", true)
+
+		msg := <-out
+		Expect(msg.Type).To(Equal("command"))
+		Expect(msg.Body).To(Equal("stop heating boiler"))
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "interlock.log"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(ContainSubstring(`"gadget":"boiler heater"`))
+	})
+
+	It("lets the heater fire with enough in the boiler", func() {
+		volume("boiler", 5.0)
+		gadget("boiler heater", true)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("stops filling the hlt at its capacity", func() {
+		gadget("hlt valve", true)
+		volume("hlt", 6.0)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+
+		volume("hlt", 7.0)
+		msg := <-out
+		Expect(msg.Body).To(Equal("stop filling hlt"))
+
+		//only once until the valve is turned off and on again
+		volume("hlt", 7.1)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+
+		gadget("hlt valve", false)
+		gadget("hlt valve", true)
+		msg = <-out
+		Expect(msg.Body).To(Equal("stop filling hlt"))
+	})
+})
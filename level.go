@@ -0,0 +1,87 @@
+package brewery
+
+import (
+	"log"
+
+	"github.com/cswank/gogadgets"
+)
+
+// LevelSwitch is a float switch mounted in a vessel at a
+// known volume.  Whenever it changes (in either direction)
+// the liquid is level with it, so the vessel's estimated
+// volume is re-anchored.  A switch at 0 is a low level switch
+// that tells when a vessel is empty.
+type LevelSwitch struct {
+	Pin string `json:"pin"`
+
+	//Volume (gallons) of the vessel when the liquid is level
+	//with the switch.
+	Volume float64 `json:"volume"`
+
+	//Edge is "rising", "falling" or "both" (the default).
+	Edge string `json:"edge,omitempty"`
+}
+
+type levelSwitch struct {
+	LevelSwitch
+	vessel string
+	poller gogadgets.Poller
+}
+
+// vesselSwitches returns the level switches of a vessel.  The
+// legacy float switch is a rising edge switch at the vessel's
+// capacity on Config.FloatSwitchPin.
+func vesselSwitches(cfg *Config, vessel Vessel) []LevelSwitch {
+	switches := vessel.Switches
+	if vessel.FloatSwitch {
+		switches = append(switches, LevelSwitch{Pin: cfg.FloatSwitchPin, Volume: vessel.Capacity, Edge: "rising"})
+	}
+	return switches
+}
+
+// addSwitches creates the pollers for the level switches of
+// every vessel.
+func (v *volumeManager) addSwitches(cfg *Config, vessels []Vessel) error {
+	for _, vessel := range vessels {
+		for _, sw := range vesselSwitches(cfg, vessel) {
+			p, err := v.switchPoller(cfg, sw)
+			if err != nil {
+				return err
+			}
+			v.switches = append(v.switches, &levelSwitch{LevelSwitch: sw, vessel: vessel.Name, poller: p})
+		}
+	}
+	return nil
+}
+
+func (v *volumeManager) switchPoller(cfg *Config, sw LevelSwitch) (gogadgets.Poller, error) {
+	if p, ok := v.pollers[sw.Pin]; ok {
+		return p, nil
+	}
+
+	if v.poller != nil && sw.Pin == cfg.FloatSwitchPin {
+		return v.poller, nil
+	}
+
+	edge := sw.Edge
+	if edge == "" {
+		edge = "both"
+	}
+	return newPoller(sw.Pin, edge)
+}
+
+// watch re-anchors the vessel's volume (and clears its
+// uncertainty) every time the switch changes.
+func (v *volumeManager) watch(s *levelSwitch) {
+	for {
+		if _, err := s.poller.Wait(); err != nil {
+			log.Printf("level switch %s Wait() error: %s", s.Pin, err)
+			return
+		}
+
+		v.events <- func() {
+			v.measured(s.vessel, s.Volume*gallonsToML)
+			v.changed(s.vessel)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package brewery_test
+
+import (
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Level switches", func() {
+	var (
+		low, mid chan bool
+		in, out  chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		low = make(chan bool)
+		mid = make(chan bool)
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+
+		cfg := &brewery.Config{
+			Vessels: []brewery.Vessel{
+				{
+					Name: "boiler",
+					Switches: []brewery.LevelSwitch{
+						{Pin: "low", Volume: 0.0},
+						{Pin: "mid", Volume: 2.0},
+					},
+				},
+			},
+		}
+
+		b, err := brewery.New(
+			cfg,
+			brewery.WithLevelSwitch("low", &FakePoller{trigger: low}),
+			brewery.WithLevelSwitch("mid", &FakePoller{trigger: mid}),
+		)
+		Expect(err).To(BeNil())
+
+		go b.Tank("boiler").Start(out, in)
+		<-in
+	})
+
+	It("re-anchors the volume whenever a switch changes", func() {
+		mid <- true
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(2.0))
+
+		out <- gogadgets.Message{Type: "command", Body: "set boiler volume to 1.5 gallons"}
+		msg = <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(1.5))
+
+		mid <- false
+		msg = <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(2.0))
+	})
+
+	It("knows a vessel is empty when the low level switch opens", func() {
+		out <- gogadgets.Message{Type: "command", Body: "set boiler volume to 0.5 gallons"}
+		<-in
+
+		low <- false
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+	})
+})
@@ -0,0 +1,50 @@
+package brewery
+
+import (
+	"log"
+	"sync"
+
+	"github.com/cswank/gogadgets"
+)
+
+// flowMeter counts the pulses from a hall effect flow meter.
+// When a transfer has one it is used instead of the transfer's
+// flow model.
+type flowMeter struct {
+	lock    sync.Mutex
+	poller  gogadgets.Poller
+	kFactor float64
+	pulses  int
+}
+
+func newFlowMeter(p gogadgets.Poller, kFactor float64) *flowMeter {
+	m := &flowMeter{poller: p, kFactor: kFactor}
+	go m.count()
+	return m
+}
+
+func (m *flowMeter) count() {
+	for {
+		if _, err := m.poller.Wait(); err != nil {
+			log.Println("flow meter Wait() error", err)
+			return
+		}
+		m.lock.Lock()
+		m.pulses++
+		m.lock.Unlock()
+	}
+}
+
+func (m *flowMeter) reset() {
+	m.lock.Lock()
+	m.pulses = 0
+	m.lock.Unlock()
+}
+
+// volume is the ml that have flowed since the last reset.
+func (m *flowMeter) volume() float64 {
+	m.lock.Lock()
+	p := m.pulses
+	m.lock.Unlock()
+	return float64(p) / m.kFactor * 1000.0
+}
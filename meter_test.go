@@ -0,0 +1,78 @@
+package brewery_test
+
+import (
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flow meter", func() {
+	var (
+		afterTrigger, pulses chan bool
+		in, out, hltIn       chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		afterTrigger = make(chan bool)
+		pulses = make(chan bool)
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+		hltIn = make(chan gogadgets.Message)
+
+		cfg := &brewery.Config{
+			FlowMeterKFactor: 450.0,
+			Vessels: []brewery.Vessel{
+				{Name: "tun"},
+				{Name: "hlt"},
+			},
+			Transfers: []brewery.Transfer{
+				{From: "hlt", To: "tun", Gadget: "tun valve", Flow: brewery.FlowConfig{Type: "pump", Rate: 100.0}},
+			},
+		}
+
+		b, err := brewery.New(
+			cfg,
+			brewery.WithAfter((&FakeAfter{trigger: afterTrigger}).After),
+			brewery.WithTimer(&fakeTimer{}),
+			brewery.WithFlowMeter("tun valve", &FakePoller{trigger: pulses}),
+		)
+		Expect(err).To(BeNil())
+
+		go b.Tank("tun").Start(out, in)
+		go b.Tank("hlt").Start(make(chan gogadgets.Message), hltIn)
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+		msg = <-hltIn
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+	})
+
+	It("measures the volume moved with the flow meter", func() {
+		out <- gogadgets.Message{
+			Type:   "update",
+			Sender: "tun valve",
+			Value: gogadgets.Value{
+				Value: true,
+			},
+		}
+
+		//the first tick means the meter has been reset
+		afterTrigger <- true
+		<-hltIn
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+
+		for i := 0; i < 900; i++ {
+			pulses <- true
+		}
+
+		//the hlt is empty, but the meter is trusted over the
+		//pump's estimate.
+		Eventually(func() float64 {
+			afterTrigger <- true
+			<-hltIn
+			msg := <-in
+			return msg.Value.Value.(float64)
+		}).Should(BeNumerically("~", 2000.0/3785.41, 1e-9))
+	})
+})
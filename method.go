@@ -0,0 +1,84 @@
+package brewery
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cswank/gogadgets"
+)
+
+// methodRunner is the uid of gogadgets' method runner.
+const methodRunner = "method runner"
+
+// Method is a gadget that submits the steps of a brew (see
+// recipes.Recipe.Method) to gogadgets' method runner as the
+// active method, and publishes the progress of each step.
+type Method struct {
+	name  string
+	steps []string
+	step  int
+	done  bool
+	out   chan<- gogadgets.Message
+}
+
+// NewMethod returns a Method that runs steps.  The name (of
+// the recipe) is the location of its progress updates.
+func NewMethod(name string, steps []string) *Method {
+	return &Method{name: name, steps: steps, step: -1}
+}
+
+func (m *Method) GetUID() string {
+	return "method"
+}
+
+func (m *Method) GetDirection() string {
+	return "input"
+}
+
+func (m *Method) Start(input <-chan gogadgets.Message, out chan<- gogadgets.Message) {
+	m.out = out
+	m.send(gogadgets.Message{
+		Type:   "method",
+		Method: gogadgets.Method{Steps: m.steps},
+	})
+
+	for msg := range input {
+		m.readMessage(msg)
+	}
+}
+
+// readMessage publishes a step update whenever the method
+// runner moves on to the next step.
+func (m *Method) readMessage(msg gogadgets.Message) {
+	if msg.Type != "update" || msg.Sender != methodRunner || m.done || msg.Method.Step == m.step {
+		return
+	}
+
+	m.step = msg.Method.Step
+	if m.step < 0 || m.step >= len(m.steps) {
+		m.done = true
+		m.send(gogadgets.Message{
+			Type:     "update",
+			Location: m.name,
+			Name:     "method",
+			Body:     fmt.Sprintf("finished %d steps", len(m.steps)),
+			Value:    gogadgets.Value{Value: float64(len(m.steps)), Units: "steps"},
+		})
+		return
+	}
+
+	m.send(gogadgets.Message{
+		Type:     "update",
+		Location: m.name,
+		Name:     "method",
+		Body:     m.steps[m.step],
+		Value:    gogadgets.Value{Value: float64(m.step + 1), Units: fmt.Sprintf("of %d steps", len(m.steps))},
+	})
+}
+
+func (m *Method) send(msg gogadgets.Message) {
+	msg.UUID = gogadgets.GetUUID()
+	msg.Sender = m.GetUID()
+	msg.Timestamp = time.Now().UTC()
+	m.out <- msg
+}
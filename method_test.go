@@ -0,0 +1,64 @@
+package brewery_test
+
+import (
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Method", func() {
+	var (
+		in, out chan gogadgets.Message
+		steps   []string
+	)
+
+	BeforeEach(func() {
+		steps = []string{"fill hlt to 7.0 gallons", "heat hlt to 165 F", "wait for hlt temperature >= 165 F"}
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+		go brewery.NewMethod("stout", steps).Start(in, out)
+	})
+
+	runner := func(step int) {
+		in <- gogadgets.Message{
+			Type:   "update",
+			Sender: "method runner",
+			Method: gogadgets.Method{Step: step, Steps: steps},
+		}
+	}
+
+	It("submits the method", func() {
+		msg := <-out
+		Expect(msg.Type).To(Equal("method"))
+		Expect(msg.Sender).To(Equal("method"))
+		Expect(msg.Method.Steps).To(Equal(steps))
+	})
+
+	It("publishes the progress of the method", func() {
+		<-out
+
+		runner(0)
+		msg := <-out
+		Expect(msg.Type).To(Equal("update"))
+		Expect(msg.Location).To(Equal("stout"))
+		Expect(msg.Body).To(Equal("fill hlt to 7.0 gallons"))
+		Expect(msg.Value.Value).To(Equal(1.0))
+		Expect(msg.Value.Units).To(Equal("of 3 steps"))
+
+		//the runner sends updates that aren't a new step too
+		runner(0)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+
+		runner(1)
+		msg = <-out
+		Expect(msg.Body).To(Equal("heat hlt to 165 F"))
+		Expect(msg.Value.Value).To(Equal(2.0))
+
+		runner(3)
+		msg = <-out
+		Expect(msg.Body).To(Equal("finished 3 steps"))
+	})
+})
@@ -0,0 +1,151 @@
+package brewery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	standardGravity = 9.80665 //m/s^2
+
+	defaultPressureInterval = time.Second
+	defaultPressureDeadband = 50.0 //ml
+)
+
+// PressureSensor reads the hydrostatic pressure (kPa) of the
+// liquid above a sensor at the bottom of a vessel.
+type PressureSensor interface {
+	Pressure() (float64, error)
+}
+
+// PressureConfig is a pressure transducer on a vessel's drain
+// that is read with an ADC.  Its readings are converted to the
+// height of the liquid and then, with the vessel's Geometry,
+// to volume.  They are trusted over any flow model.
+type PressureConfig struct {
+	//ADC is the sysfs file of the adc channel, as in
+	//"/sys/bus/iio/devices/iio:device0/in_voltage0_raw".
+	//Zero is its reading at 0 kPa and Scale the kPa per count.
+	ADC   string  `json:"adc"`
+	Zero  float64 `json:"zero"`
+	Scale float64 `json:"scale"`
+
+	//Offset (cm) is the height of the sensor above the bottom
+	//of the vessel.
+	Offset float64 `json:"offset,omitempty"`
+
+	//Gravity is the specific gravity of the liquid, 1.0 by
+	//default.
+	Gravity float64 `json:"gravity,omitempty"`
+
+	//Interval (s) is how often the sensor is read (1 by
+	//default), and the volume is only updated when it changes
+	//by more than Deadband (50 ml by default).
+	Interval float64 `json:"interval,omitempty"`
+	Deadband float64 `json:"deadband,omitempty"`
+}
+
+// Level (cm) of liquid that exerts kPa on the sensor.
+func (p PressureConfig) Level(kPa float64) float64 {
+	sg := p.Gravity
+	if sg == 0 {
+		sg = 1.0
+	}
+	//kPa / (kg/l * m/s^2) is m, times 100 for cm.
+	return kPa*100.0/(sg*standardGravity) + p.Offset
+}
+
+type pressureSensor struct {
+	PressureConfig
+	vessel   string
+	geometry Geometry
+	sensor   PressureSensor
+}
+
+// adc reads a raw adc channel from sysfs.
+type adc struct {
+	path        string
+	zero, scale float64
+}
+
+func (a *adc) Pressure() (float64, error) {
+	b, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return (raw - a.zero) * a.scale, nil
+}
+
+// addPressureSensors makes the vessels with a pressure sensor
+// read it instead of relying on estimates.
+func (v *volumeManager) addPressureSensors(vessels []Vessel) error {
+	for _, vessel := range vessels {
+		if vessel.Pressure == nil {
+			continue
+		}
+
+		if vessel.Geometry == nil {
+			return fmt.Errorf("the pressure sensor in %s needs the vessel's geometry", vessel.Name)
+		}
+
+		s, ok := v.pressures[vessel.Name]
+		if !ok {
+			if vessel.Pressure.ADC == "" {
+				return fmt.Errorf("the pressure sensor in %s needs an adc", vessel.Name)
+			}
+			s = &adc{path: vessel.Pressure.ADC, zero: vessel.Pressure.Zero, scale: vessel.Pressure.Scale}
+		}
+
+		v.sensors = append(v.sensors, &pressureSensor{
+			PressureConfig: *vessel.Pressure,
+			vessel:         vessel.Name,
+			geometry:       *vessel.Geometry,
+			sensor:         s,
+		})
+		v.sensed[vessel.Name] = true
+	}
+	return nil
+}
+
+// sense reads a pressure sensor for as long as the brewery
+// runs.
+func (v *volumeManager) sense(s *pressureSensor) {
+	interval := defaultPressureInterval
+	if s.Interval > 0 {
+		interval = time.Duration(s.Interval * float64(time.Second))
+	}
+
+	deadband := defaultPressureDeadband
+	if s.Deadband > 0 {
+		deadband = s.Deadband
+	}
+
+	for {
+		<-v.after(interval)
+		kPa, err := s.sensor.Pressure()
+		if err != nil {
+			log.Printf("pressure sensor in %s error: %s", s.vessel, err)
+			continue
+		}
+
+		ml := s.geometry.Volume(s.Level(kPa))
+		v.events <- func() {
+			if math.Abs(v.volumes[s.vessel]-ml) < deadband {
+				return
+			}
+			v.volumes[s.vessel] = ml
+			v.uncertainties[s.vessel] = 0
+			v.changed(s.vessel)
+		}
+	}
+}
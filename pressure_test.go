@@ -0,0 +1,97 @@
+package brewery_test
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePressure struct {
+	lock sync.Mutex
+	kPa  float64
+}
+
+func (f *fakePressure) set(kPa float64) {
+	f.lock.Lock()
+	f.kPa = kPa
+	f.lock.Unlock()
+}
+
+func (f *fakePressure) Pressure() (float64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.kPa, nil
+}
+
+var _ = Describe("Pressure sensor", func() {
+	var (
+		sensor  *fakePressure
+		in, out chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		sensor = &fakePressure{}
+		in = make(chan gogadgets.Message, 100)
+		out = make(chan gogadgets.Message)
+
+		cfg := &brewery.Config{
+			Units: "ml",
+			Vessels: []brewery.Vessel{
+				{
+					Name:     "tun",
+					Geometry: &brewery.Geometry{Radius: 20},
+					Pressure: &brewery.PressureConfig{Offset: 1},
+				},
+			},
+		}
+
+		fast := func(d time.Duration) <-chan time.Time {
+			return time.After(time.Millisecond)
+		}
+
+		b, err := brewery.New(cfg, brewery.WithAfter(fast), brewery.WithPressureSensor("tun", sensor))
+		Expect(err).To(BeNil())
+		go b.Tank("tun").Start(out, in)
+		<-in
+	})
+
+	//volume skips the usable volume and level updates.
+	volume := func() float64 {
+		for {
+			msg := <-in
+			if msg.Name == "volume" {
+				return msg.Value.Value.(float64)
+			}
+		}
+	}
+
+	It("converts the pressure to volume", func() {
+		//9 cm of water above a sensor 1 cm off the bottom
+		sensor.set(9 * 9.80665 / 100)
+		Expect(volume()).To(BeNumerically("~", math.Pi*400*10, 1e-6))
+	})
+
+	It("ignores changes inside the deadband", func() {
+		sensor.set(9 * 9.80665 / 100)
+		volume()
+
+		out <- gogadgets.Message{Type: "command", Body: "add 10 ml to tun"}
+		Expect(volume()).To(BeNumerically("~", math.Pi*400*10+10, 1e-6))
+		<-in
+		<-in
+		Consistently(in, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("needs the vessel's geometry", func() {
+		cfg := &brewery.Config{
+			Vessels: []brewery.Vessel{{Name: "tun", Pressure: &brewery.PressureConfig{}}},
+		}
+		_, err := brewery.New(cfg, brewery.WithPressureSensor("tun", sensor))
+		Expect(err).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,321 @@
+package recipes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const beerJSONVersion = 1.0
+
+// The recipe type, mash name and mash step type that are
+// written when a recipe doesn't have its own.  Steps without a
+// name are written as "step 1", "step 2"...
+const (
+	defaultRecipeType   = "all grain"
+	defaultMashName     = "mash"
+	defaultMashStepType = "infusion"
+)
+
+// beerJSON is a BeerJSON 1.0 document.  Only the parts of the
+// standard that a Recipe holds are read and written.
+type beerJSON struct {
+	BeerJSON struct {
+		Version float64          `json:"version"`
+		Recipes []beerJSONRecipe `json:"recipes"`
+	} `json:"beerjson"`
+}
+
+type beerJSONRecipe struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Author     string   `json:"author"`
+	BatchSize  quantity `json:"batch_size"`
+	Efficiency struct {
+		Brewhouse quantity `json:"brewhouse"`
+	} `json:"efficiency"`
+	Boil        *beerJSONBoil `json:"boil,omitempty"`
+	Ingredients struct {
+		Fermentables []beerJSONFermentable `json:"fermentable_additions"`
+		Hops         []beerJSONHop         `json:"hop_additions,omitempty"`
+		Cultures     []beerJSONCulture     `json:"culture_additions,omitempty"`
+	} `json:"ingredients"`
+	Mash *beerJSONMash `json:"mash,omitempty"`
+}
+
+type beerJSONBoil struct {
+	PreBoilSize quantity `json:"pre_boil_size"`
+	BoilTime    quantity `json:"boil_time"`
+}
+
+type beerJSONMash struct {
+	Name             string             `json:"name"`
+	GrainTemperature *quantity          `json:"grain_temperature,omitempty"`
+	Steps            []beerJSONMashStep `json:"mash_steps"`
+}
+
+type beerJSONFermentable struct {
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`
+	Yield struct {
+		Potential *quantity `json:"potential,omitempty"`
+		FineGrind *quantity `json:"fine_grind,omitempty"`
+	} `json:"yield"`
+	Color  quantity `json:"color"`
+	Amount quantity `json:"amount"`
+}
+
+type beerJSONHop struct {
+	Name   string    `json:"name"`
+	Alpha  quantity  `json:"alpha_acid"`
+	Beta   *quantity `json:"beta_acid,omitempty"`
+	Form   string    `json:"form,omitempty"`
+	Amount quantity  `json:"amount"`
+	Timing struct {
+		Use  string    `json:"use,omitempty"`
+		Time *quantity `json:"time,omitempty"`
+	} `json:"timing"`
+}
+
+type beerJSONCulture struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type,omitempty"`
+	Form        string    `json:"form,omitempty"`
+	Attenuation *quantity `json:"attenuation,omitempty"`
+}
+
+type beerJSONMashStep struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Temperature quantity `json:"step_temperature"`
+	Time        quantity `json:"step_time"`
+}
+
+// hopUse is the prefix of the BeerJSON timing of a hop, as in
+// add_to_boil.
+const hopUse = "add_to_"
+
+// quantity is how BeerJSON writes every measurement.
+type quantity struct {
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+// in converts q into the units of table (see units.go).
+func (q quantity) in(table map[string]float64, kind string) (float64, error) {
+	f, ok := table[strings.ToLower(q.Unit)]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s units %q", kind, q.Unit)
+	}
+	return q.Value * f, nil
+}
+
+// NewBeerJSON reads the first recipe of a BeerJSON 1.0
+// document.  Its amounts are converted to the lb, oz, gallons
+// and minutes that the rest of a Recipe uses.
+func NewBeerJSON(r io.Reader, opts ...recipieOption) (*Recipe, error) {
+	out := newRecipe(opts...)
+
+	var doc beerJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.BeerJSON.Recipes) == 0 {
+		return nil, fmt.Errorf("the BeerJSON document has no recipes")
+	}
+
+	return out, out.fromBeerJSON(doc.BeerJSON.Recipes[0])
+}
+
+func (r *Recipe) fromBeerJSON(x beerJSONRecipe) error {
+	var err error
+	r.Name = x.Name
+	r.Type = x.Type
+	r.Author = x.Author
+	r.Efficiency = x.Efficiency.Brewhouse.Value
+	if r.BatchSize, err = x.BatchSize.in(gallonsPer, "volume"); err != nil {
+		return err
+	}
+
+	if x.Boil != nil {
+		if r.BoilSize, err = x.Boil.PreBoilSize.in(gallonsPer, "volume"); err != nil {
+			return err
+		}
+		if r.BoilTime, err = x.Boil.BoilTime.in(minutesPer, "time"); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range x.Ingredients.Fermentables {
+		fm := Fermentable{Name: f.Name, Unit: "lb"}
+		if fm.Amount, err = f.Amount.in(lbPer, "mass"); err != nil {
+			return err
+		}
+
+		color, err := lovibond(f.Color)
+		if err != nil {
+			return err
+		}
+		fm.Color = int(color + 0.5)
+
+		switch {
+		case f.Yield.Potential != nil:
+			sg, err := specificGravity(*f.Yield.Potential)
+			if err != nil {
+				return err
+			}
+			fm.PPG = (sg - 1.0) * 1000.0
+		case f.Yield.FineGrind != nil:
+			if f.Yield.FineGrind.Unit != "%" {
+				return fmt.Errorf("unknown yield units %q", f.Yield.FineGrind.Unit)
+			}
+			fm.PPG = f.Yield.FineGrind.Value * sucrosePPG / 100.0
+		}
+		r.Fermentables = append(r.Fermentables, fm)
+	}
+
+	for _, h := range x.Ingredients.Hops {
+		hop := Hop{Name: h.Name, Alpha: h.Alpha.Value, Form: h.Form, Use: strings.TrimPrefix(h.Timing.Use, hopUse)}
+		if h.Beta != nil {
+			hop.Beta = h.Beta.Value
+		}
+
+		lb, err := h.Amount.in(lbPer, "mass")
+		if err != nil {
+			return err
+		}
+		hop.Amount = lb * 16.0
+
+		if h.Timing.Time != nil {
+			if hop.Time, err = h.Timing.Time.in(minutesPer, "time"); err != nil {
+				return err
+			}
+		}
+		r.Hops = append(r.Hops, hop)
+	}
+
+	for _, c := range x.Ingredients.Cultures {
+		y := Yeast{Name: c.Name, Type: c.Type, Form: c.Form}
+		if c.Attenuation != nil {
+			y.Attenuation = c.Attenuation.Value
+		}
+		r.Yeasts = append(r.Yeasts, y)
+	}
+
+	if x.Mash == nil {
+		return nil
+	}
+
+	for _, s := range x.Mash.Steps {
+		step := MashStep{Name: s.Name, Type: s.Type, Temperature: s.Temperature.Value}
+		switch strings.ToUpper(s.Temperature.Unit) {
+		case "C":
+			step.Metric = true
+		case "F":
+		default:
+			return fmt.Errorf("unknown temperature units %q", s.Temperature.Unit)
+		}
+
+		if step.Time, err = s.Time.in(minutesPer, "time"); err != nil {
+			return err
+		}
+		r.MashSteps = append(r.MashSteps, step)
+	}
+	return nil
+}
+
+// WriteBeerJSON writes the recipe as a BeerJSON 1.0 document.
+// The fields that BeerJSON requires are always written, with
+// defaults when the recipe doesn't have them.
+func (r *Recipe) WriteBeerJSON(w io.Writer) error {
+	var doc beerJSON
+	doc.BeerJSON.Version = beerJSONVersion
+	doc.BeerJSON.Recipes = []beerJSONRecipe{r.toBeerJSON()}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (r *Recipe) toBeerJSON() beerJSONRecipe {
+	x := beerJSONRecipe{
+		Name:      r.Name,
+		Type:      r.Type,
+		Author:    r.Author,
+		BatchSize: quantity{Unit: "gal", Value: r.BatchSize},
+	}
+	if x.Type == "" {
+		x.Type = defaultRecipeType
+	}
+	x.Efficiency.Brewhouse = quantity{Unit: "%", Value: r.Efficiency}
+
+	x.Boil = &beerJSONBoil{
+		PreBoilSize: quantity{Unit: "gal", Value: r.BoilSize},
+		BoilTime:    quantity{Unit: "min", Value: r.BoilTime},
+	}
+
+	x.Ingredients.Fermentables = []beerJSONFermentable{}
+	for _, f := range r.Fermentables {
+		fm := beerJSONFermentable{
+			Name:   f.Name,
+			Color:  quantity{Unit: "Lovi", Value: float64(f.Color)},
+			Amount: quantity{Unit: "lb", Value: f.Amount},
+		}
+		if _, ok := lbPer[strings.ToLower(f.Unit)]; ok {
+			fm.Amount.Unit = f.Unit
+		}
+		fm.Yield.Potential = &quantity{Unit: "sg", Value: 1.0 + f.PPG/1000.0}
+		x.Ingredients.Fermentables = append(x.Ingredients.Fermentables, fm)
+	}
+
+	for _, h := range r.Hops {
+		hop := beerJSONHop{
+			Name:   h.Name,
+			Alpha:  quantity{Unit: "%", Value: h.Alpha},
+			Beta:   &quantity{Unit: "%", Value: h.Beta},
+			Form:   h.Form,
+			Amount: quantity{Unit: "oz", Value: h.Amount},
+		}
+		if h.Use != "" {
+			hop.Timing.Use = hopUse + h.Use
+		}
+		hop.Timing.Time = &quantity{Unit: "min", Value: h.Time}
+		x.Ingredients.Hops = append(x.Ingredients.Hops, hop)
+	}
+
+	for _, y := range r.Yeasts {
+		x.Ingredients.Cultures = append(x.Ingredients.Cultures, beerJSONCulture{
+			Name:        y.Name,
+			Type:        y.Type,
+			Form:        y.Form,
+			Attenuation: &quantity{Unit: "%", Value: y.Attenuation},
+		})
+	}
+
+	if len(r.MashSteps) == 0 {
+		return x
+	}
+
+	x.Mash = &beerJSONMash{Name: defaultMashName}
+	for i, s := range r.MashSteps {
+		step := beerJSONMashStep{
+			Name:        s.Name,
+			Type:        s.Type,
+			Temperature: quantity{Unit: "F", Value: s.Temperature},
+			Time:        quantity{Unit: "min", Value: s.Time},
+		}
+		if s.Metric {
+			step.Temperature.Unit = "C"
+		}
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if step.Type == "" {
+			step.Type = defaultMashStepType
+		}
+		x.Mash.Steps = append(x.Mash.Steps, step)
+	}
+	return x
+}
@@ -0,0 +1,157 @@
+package recipes
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	kgToLB       = 2.20462262
+	kgToOZ       = 35.2739619
+	litersPerGal = 3.78541178
+)
+
+// beerXML is the part of a BeerXML 1.0 document (as exported
+// by BeerSmith, Brewfather and friends) that a Recipe needs.
+// BeerXML is always metric: kg, liters and C.
+type beerXML struct {
+	Recipes []struct {
+		Name         string  `xml:"NAME"`
+		Type         string  `xml:"TYPE"`
+		Brewer       string  `xml:"BREWER"`
+		BatchSize    float64 `xml:"BATCH_SIZE"`
+		BoilSize     float64 `xml:"BOIL_SIZE"`
+		BoilTime     float64 `xml:"BOIL_TIME"`
+		Efficiency   float64 `xml:"EFFICIENCY"`
+		Fermentables []struct {
+			Name   string  `xml:"NAME"`
+			Amount float64 `xml:"AMOUNT"`
+			Color  float64 `xml:"COLOR"`
+			Yield  float64 `xml:"YIELD"`
+		} `xml:"FERMENTABLES>FERMENTABLE"`
+		Hops []struct {
+			Name   string  `xml:"NAME"`
+			Amount float64 `xml:"AMOUNT"`
+			Alpha  float64 `xml:"ALPHA"`
+			Beta   float64 `xml:"BETA"`
+			Time   float64 `xml:"TIME"`
+			Form   string  `xml:"FORM"`
+			Use    string  `xml:"USE"`
+		} `xml:"HOPS>HOP"`
+		Yeasts []struct {
+			Name        string  `xml:"NAME"`
+			Type        string  `xml:"TYPE"`
+			Form        string  `xml:"FORM"`
+			Attenuation float64 `xml:"ATTENUATION"`
+		} `xml:"YEASTS>YEAST"`
+		MashSteps []struct {
+			Name        string  `xml:"NAME"`
+			Type        string  `xml:"TYPE"`
+			Temperature float64 `xml:"STEP_TEMP"`
+			Time        float64 `xml:"STEP_TIME"`
+		} `xml:"MASH>MASH_STEPS>MASH_STEP"`
+	} `xml:"RECIPE"`
+}
+
+// NewBeerXML reads the first recipe of a BeerXML 1.0 document.
+// Its amounts are converted to the lb, oz, gallons and F that
+// the rest of a Recipe uses.
+func NewBeerXML(r io.Reader, opts ...recipieOption) (*Recipe, error) {
+	out := newRecipe(opts...)
+
+	var doc beerXML
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Recipes) == 0 {
+		return nil, fmt.Errorf("the BeerXML document has no recipes")
+	}
+
+	x := doc.Recipes[0]
+	out.Name = x.Name
+	out.Type = strings.ToLower(x.Type)
+	out.Author = x.Brewer
+	out.BatchSize = x.BatchSize / litersPerGal
+	out.BoilSize = x.BoilSize / litersPerGal
+	out.BoilTime = x.BoilTime
+	out.Efficiency = x.Efficiency
+
+	for _, f := range x.Fermentables {
+		out.Fermentables = append(out.Fermentables, Fermentable{
+			Name:   f.Name,
+			Amount: f.Amount * kgToLB,
+			Color:  int(f.Color + 0.5),
+			Unit:   "lb",
+			PPG:    f.Yield * sucrosePPG / 100.0,
+		})
+	}
+
+	for _, h := range x.Hops {
+		out.Hops = append(out.Hops, Hop{
+			Name:   h.Name,
+			Amount: h.Amount * kgToOZ,
+			Alpha:  h.Alpha,
+			Beta:   h.Beta,
+			Time:   h.Time,
+			Form:   strings.ToLower(h.Form),
+			Use:    beerXMLHopUses[strings.ToLower(h.Use)],
+		})
+	}
+
+	for _, y := range x.Yeasts {
+		out.Yeasts = append(out.Yeasts, Yeast{
+			Name:        y.Name,
+			Attenuation: y.Attenuation,
+			Type:        strings.ToLower(y.Type),
+			Form:        strings.ToLower(y.Form),
+		})
+	}
+
+	for _, s := range x.MashSteps {
+		out.MashSteps = append(out.MashSteps, MashStep{
+			Temperature: s.Temperature*9.0/5.0 + 32.0,
+			Time:        s.Time,
+			Name:        s.Name,
+			Type:        strings.ToLower(s.Type),
+		})
+	}
+
+	return out, nil
+}
+
+// beerXMLHopUses turn the USE of a BeerXML hop into the Use of
+// a Hop.
+var beerXMLHopUses = map[string]string{
+	"mash":       "mash",
+	"first wort": "boil",
+	"boil":       "boil",
+	"aroma":      "boil",
+	"dry hop":    "fermentation",
+}
+
+// charsetReader lets the decoder read the ISO-8859-1 documents
+// that BeerSmith exports.
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+	default:
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.NewReader(string(runes)), nil
+}
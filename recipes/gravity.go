@@ -0,0 +1,69 @@
+package recipes
+
+import "strings"
+
+const (
+	//defaultEfficiency and defaultAttenuation (%) are used
+	//when a recipe doesn't have its own.
+	defaultEfficiency  = 75.0
+	defaultAttenuation = 75.0
+)
+
+// OG is the estimated original gravity of the recipe, from the
+// ppg of its fermentables, its efficiency and batch size.
+func (r *Recipe) OG() float64 {
+	return 1.0 + r.points(r.BatchSize)/1000.0
+}
+
+// FG is the estimated final gravity, from the OG and the
+// attenuation of the yeast.
+func (r *Recipe) FG() float64 {
+	return 1.0 + (r.OG()-1.0)*(1.0-r.attenuation()/100.0)
+}
+
+// ABV is the estimated alcohol by volume (%).
+func (r *Recipe) ABV() float64 {
+	return (r.OG() - r.FG()) * 131.25
+}
+
+// points are the gravity points (as in 1.050 is 50) that the
+// fermentables yield in gallons of wort.
+func (r *Recipe) points(gallons float64) float64 {
+	if gallons <= 0 {
+		return 0
+	}
+
+	eff := r.Efficiency
+	if eff == 0 {
+		eff = defaultEfficiency
+	}
+
+	var p float64
+	for _, f := range r.Fermentables {
+		p += f.pounds() * f.PPG
+	}
+	return p * eff / 100.0 / gallons
+}
+
+// attenuation is the highest attenuation (%) of the yeasts.
+func (r *Recipe) attenuation() float64 {
+	var a float64
+	for _, y := range r.Yeasts {
+		if y.Attenuation > a {
+			a = y.Attenuation
+		}
+	}
+
+	if a == 0 {
+		return defaultAttenuation
+	}
+	return a
+}
+
+// pounds is the amount of the fermentable in lb.
+func (f Fermentable) pounds() float64 {
+	if lb, ok := lbPer[strings.ToLower(f.Unit)]; ok {
+		return f.Amount * lb
+	}
+	return f.Amount
+}
@@ -0,0 +1,87 @@
+package recipes
+
+import (
+	"math"
+	"strings"
+)
+
+// pelletUtilization is how much more alpha acid pellets give
+// up in the boil than whole hops, which the formulas are for.
+const pelletUtilization = 1.1
+
+// IBUFormula is a model of the IBUs a hop adds to gallons of
+// beer when it is boiled in wort of boilGravity.
+type IBUFormula func(h Hop, boilGravity, gallons float64) float64
+
+// Tinseth is Glenn Tinseth's formula.
+func Tinseth(h Hop, boilGravity, gallons float64) float64 {
+	bigness := 1.65 * math.Pow(0.000125, boilGravity-1.0)
+	boilTime := (1.0 - math.Exp(-0.04*h.Time)) / 4.15
+	return bigness * boilTime * h.mgPerLiter(gallons)
+}
+
+// Rager is Jackie Rager's formula.
+func Rager(h Hop, boilGravity, gallons float64) float64 {
+	utilization := (18.11 + 13.86*math.Tanh((h.Time-31.32)/18.27)) / 100.0
+	adjustment := 1.0
+	if boilGravity > 1.050 {
+		adjustment += (boilGravity - 1.050) / 0.2
+	}
+	return utilization * h.mgPerLiter(gallons) / adjustment
+}
+
+// mgPerLiter is the alpha acid (mg/l) the hop adds to gallons.
+func (h Hop) mgPerLiter(gallons float64) float64 {
+	return h.Alpha / 100.0 * h.Amount * 7490.0 / gallons
+}
+
+// boiled is true when the hop is added to the boil.
+func (h Hop) boiled(boilTime float64) bool {
+	if h.Time <= 0 {
+		return false
+	}
+
+	if h.Use == "" {
+		return boilTime <= 0 || h.Time <= boilTime
+	}
+	return h.Use == "boil"
+}
+
+// form is the utilization adjustment for the form of the hop.
+// A hop without a form is taken to be whole.
+func (h Hop) form() float64 {
+	if strings.ToLower(h.Form) == "pellet" {
+		return pelletUtilization
+	}
+	return 1.0
+}
+
+// HopIBUs are the IBUs each of the hops add to the beer, in
+// the same order as Hops.  The boil gravity is what the grain
+// bill yields in BoilSize.  Hops that aren't boiled (their Use
+// isn't boil, or without a Use their Time is longer than the
+// BoilTime) add none.
+func (r *Recipe) HopIBUs(f IBUFormula) []float64 {
+	gravity := 1.0 + r.points(r.BoilSize)/1000.0
+	out := make([]float64, len(r.Hops))
+	if r.BatchSize <= 0 {
+		return out
+	}
+
+	for i, h := range r.Hops {
+		if !h.boiled(r.BoilTime) {
+			continue
+		}
+		out[i] = f(h, gravity, r.BatchSize) * h.form()
+	}
+	return out
+}
+
+// IBU is the total bitterness of the recipe.
+func (r *Recipe) IBU(f IBUFormula) float64 {
+	var total float64
+	for _, ibu := range r.HopIBUs(f) {
+		total += ibu
+	}
+	return total
+}
@@ -0,0 +1,96 @@
+package recipes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Format is one of the recipe formats that Load reads.
+type Format string
+
+const (
+	Brewtoad Format = "Brewtoad JSON"
+	BeerXML  Format = "BeerXML"
+	BeerJSON Format = "BeerJSON"
+)
+
+// ErrUnknownFormat is returned by Load when the recipe isn't
+// in any of the formats it knows.
+var ErrUnknownFormat = errors.New("unknown recipe format")
+
+// DecodeError is returned by Load when a recipe looks like
+// Format but can't be decoded as one.
+type DecodeError struct {
+	Format Format
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("unable to decode %s recipe: %s", e.Format, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Load reads a recipe without the caller having to know if it
+// is Brewtoad JSON (see New), BeerXML or BeerJSON.
+func Load(r io.Reader, opts ...recipieOption) (*Recipe, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := detect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var out *Recipe
+	switch f {
+	case BeerXML:
+		out, err = NewBeerXML(bytes.NewReader(b), opts...)
+	case BeerJSON:
+		out, err = NewBeerJSON(bytes.NewReader(b), opts...)
+	default:
+		out, err = New(bytes.NewReader(b), opts...)
+	}
+
+	if err != nil {
+		return nil, &DecodeError{Format: f, Err: err}
+	}
+	return out, nil
+}
+
+// detect sniffs the format of a recipe: xml is BeerXML, and
+// json is BeerJSON when it has a "beerjson" key, otherwise it
+// is Brewtoad JSON.
+func detect(b []byte) (Format, error) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return "", ErrUnknownFormat
+	}
+
+	switch b[0] {
+	case '<':
+		return BeerXML, nil
+	case '{':
+	default:
+		return "", ErrUnknownFormat
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return "", &DecodeError{Format: Brewtoad, Err: err}
+	}
+
+	if _, ok := doc["beerjson"]; ok {
+		return BeerJSON, nil
+	}
+	return Brewtoad, nil
+}
@@ -11,29 +11,96 @@ type Fermentable struct {
 	Amount float64 `json:"amount"`
 	Color  int     `json:"color"`
 	Unit   string  `json:"unit"`
+
+	//PPG is the points per pound per gallon the fermentable
+	//yields.
+	PPG float64 `json:"ppg"`
 }
 
 type Hop struct {
 	Name   string  `json:"name"`
 	Amount float64 `json:"amount"`
-	Alpha  float64 `xml:"alpha"`
-	Beta   float64 `xml:"beta"`
-	Time   float64 `xml:"time"`
+	Alpha  float64 `json:"alpha"`
+	Beta   float64 `json:"beta"`
+	Time   float64 `json:"time"`
+
+	//Form is pellet, leaf (whole) or plug.
+	Form string `json:"form,omitempty"`
+
+	//Use is when the hop is added: mash, boil, fermentation
+	//(dry hops) or package.
+	Use string `json:"use,omitempty"`
+}
+
+// brewtoadHopUses and brewtoadHopForms are what the hop_use_id
+// and hop_form_id of a Brewtoad hop mean.  The uses are in the
+// order of BeerXML's USE (mash, first wort, boil, aroma and dry
+// hop).
+var (
+	brewtoadHopUses  = map[int]string{1: "mash", 2: "boil", 3: "boil", 4: "boil", 5: "fermentation"}
+	brewtoadHopForms = map[int]string{3: "pellet"}
+)
+
+// UnmarshalJSON reads the use and form of a Brewtoad hop from
+// its ids.
+func (h *Hop) UnmarshalJSON(b []byte) error {
+	type hop Hop
+	var x struct {
+		hop
+		UseID  int `json:"hop_use_id"`
+		FormID int `json:"hop_form_id"`
+	}
+
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+
+	*h = Hop(x.hop)
+	if h.Use == "" {
+		h.Use = brewtoadHopUses[x.UseID]
+	}
+	if h.Form == "" {
+		h.Form = brewtoadHopForms[x.FormID]
+	}
+	return nil
 }
 
 type Yeast struct {
 	Name        string  `json:"name"`
 	Attenuation float64 `json:"attenuation"`
+
+	//Type is ale, lager, wine..., and Form is liquid, dry,
+	//slant or culture.
+	Type string `json:"type,omitempty"`
+	Form string `json:"form,omitempty"`
 }
 
 type MashStep struct {
 	Temperature float64 `json:"target_temperature"`
 	Metric      bool    `json:"target_temperature_is_metric"`
 	Time        float64 `json:"time"`
+
+	//Name and Type (infusion, temperature, decoction...) are
+	//only carried between BeerXML and BeerJSON.
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// fahrenheit is the step's temperature in F.
+func (m MashStep) fahrenheit() float64 {
+	if m.Metric {
+		return m.Temperature*9.0/5.0 + 32.0
+	}
+	return m.Temperature
 }
 
 type Recipe struct {
-	Name         string  `json:"name"`
+	Name string `json:"name"`
+
+	//Type (all grain, partial mash, extract...) and Author are
+	//only carried between BeerXML and BeerJSON.
+	Type         string  `json:"type,omitempty"`
+	Author       string  `json:"author,omitempty"`
 	BatchSize    float64 `json:"batch_size"`
 	BoilSize     float64 `json:"boil_size"`
 	BoilTime     float64 `json:"boil_time"`
@@ -55,6 +122,12 @@ type Mash struct {
 }
 
 func New(r io.Reader, opts ...recipieOption) (*Recipe, error) {
+	out := newRecipe(opts...)
+	dec := json.NewDecoder(r)
+	return out, dec.Decode(out)
+}
+
+func newRecipe(opts ...recipieOption) *Recipe {
 	out := &Recipe{
 		WaterRatio:   1.25,
 		strikeFactor: 0.2,
@@ -63,9 +136,7 @@ func New(r io.Reader, opts ...recipieOption) (*Recipe, error) {
 	for _, opt := range opts {
 		opt(out)
 	}
-
-	dec := json.NewDecoder(r)
-	return out, dec.Decode(out)
+	return out
 }
 
 func (r *Recipe) getMash(grainTemperature float64) *Mash {
@@ -90,7 +161,7 @@ func (r *Recipe) getGrainWeight() float64 {
 
 func (r *Recipe) targetTemperature() (t float64) {
 	if len(r.MashSteps) > 0 {
-		t = r.MashSteps[0].Temperature
+		t = r.MashSteps[0].fahrenheit()
 	} else {
 		t = 154.0
 	}
@@ -1,8 +1,16 @@
 package recipes_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/cswank/brewery/recipes"
@@ -25,6 +33,10 @@ func TestExample(t *testing.T) {
 		t.Error(recipe.Yeasts)
 	}
 
+	if h := recipe.Hops[0]; h.Alpha != 14.0 || h.Time != 55 {
+		t.Error(h)
+	}
+
 	f := recipe.Fermentables[0]
 	if f.Name != "Caramel Malt 40L" {
 		t.Error(f)
@@ -48,3 +60,387 @@ func TestExample(t *testing.T) {
 		t.Error(len(m))
 	}
 }
+
+func TestBeerXML(t *testing.T) {
+	f, err := os.Open("example.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	recipe, err := recipes.NewBeerXML(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recipe.Name != "Vladimir's Own Stout" {
+		t.Error(recipe.Name)
+	}
+	if math.Abs(recipe.BatchSize-5.0) > 1e-6 || math.Abs(recipe.BoilSize-6.25) > 1e-6 {
+		t.Error(recipe.BatchSize, recipe.BoilSize)
+	}
+	if len(recipe.Fermentables) != 4 || len(recipe.Hops) != 5 || len(recipe.Yeasts) != 1 || len(recipe.MashSteps) != 2 {
+		t.Fatal(recipe)
+	}
+
+	fm := recipe.Fermentables[0]
+	if fm.Name != "Caramel Malt 40L" || math.Abs(fm.Amount-8.0) > 1e-6 || fm.Color != 40 || fm.Unit != "lb" {
+		t.Error(fm)
+	}
+
+	h := recipe.Hops[0]
+	if h.Name != "Zeus" || math.Abs(h.Amount-1.0) > 1e-6 || h.Alpha != 14.0 || h.Time != 55.0 {
+		t.Error(h)
+	}
+
+	if recipe.Yeasts[0].Attenuation != 77.0 {
+		t.Error(recipe.Yeasts[0])
+	}
+
+	step := recipe.MashSteps[0]
+	if math.Abs(step.Temperature-154.4) > 1e-9 || step.Time != 60.0 {
+		t.Error(step)
+	}
+
+	if m := recipe.Method(75.0); len(m) != 37 {
+		t.Error(len(m))
+	}
+}
+
+func TestBeerJSON(t *testing.T) {
+	doc := `{
+  "beerjson": {
+    "version": 1.0,
+    "recipes": [
+      {
+        "name": "Dry Stout",
+        "type": "all grain",
+        "author": "cswank",
+        "batch_size": {"unit": "l", "value": 18.92705892},
+        "efficiency": {"brewhouse": {"unit": "%", "value": 72}},
+        "boil": {
+          "pre_boil_size": {"unit": "l", "value": 22.71247071},
+          "boil_time": {"unit": "hr", "value": 1}
+        },
+        "ingredients": {
+          "fermentable_additions": [
+            {
+              "name": "Maris Otter",
+              "type": "grain",
+              "yield": {"fine_grind": {"unit": "%", "value": 81}},
+              "color": {"unit": "EBC", "value": 6},
+              "amount": {"unit": "kg", "value": 3.5}
+            },
+            {
+              "name": "Roasted Barley",
+              "type": "grain",
+              "yield": {"potential": {"unit": "sg", "value": 1.025}},
+              "color": {"unit": "SRM", "value": 300},
+              "amount": {"unit": "g", "value": 450}
+            }
+          ],
+          "hop_additions": [
+            {
+              "name": "East Kent Goldings",
+              "form": "leaf",
+              "alpha_acid": {"unit": "%", "value": 5},
+              "amount": {"unit": "g", "value": 56},
+              "timing": {"use": "add_to_boil", "time": {"unit": "min", "value": 60}}
+            }
+          ],
+          "culture_additions": [
+            {"name": "Irish Ale", "type": "ale", "form": "liquid", "attenuation": {"unit": "%", "value": 73}}
+          ]
+        },
+        "mash": {
+          "name": "single infusion",
+          "grain_temperature": {"unit": "C", "value": 20},
+          "mash_steps": [
+            {"name": "sacch", "type": "infusion", "step_temperature": {"unit": "C", "value": 66}, "step_time": {"unit": "min", "value": 60}}
+          ]
+        }
+      }
+    ]
+  }
+}`
+
+	recipe, err := recipes.NewBeerJSON(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recipe.Name != "Dry Stout" || recipe.Efficiency != 72 || recipe.BoilTime != 60 {
+		t.Error(recipe)
+	}
+	if math.Abs(recipe.BatchSize-5.0) > 1e-6 || math.Abs(recipe.BoilSize-6.0) > 1e-6 {
+		t.Error(recipe.BatchSize, recipe.BoilSize)
+	}
+	if len(recipe.Fermentables) != 2 || len(recipe.Hops) != 1 || len(recipe.Yeasts) != 1 || len(recipe.MashSteps) != 1 {
+		t.Fatal(recipe)
+	}
+
+	fm := recipe.Fermentables[0]
+	if math.Abs(fm.Amount-7.7162) > 1e-3 || fm.Color != 3 || math.Abs(fm.PPG-37.43) > 0.01 || fm.Unit != "lb" {
+		t.Error(fm)
+	}
+
+	fm = recipe.Fermentables[1]
+	if math.Abs(fm.Amount-0.992) > 1e-3 || fm.Color != 222 || math.Abs(fm.PPG-25) > 1e-9 {
+		t.Error(fm)
+	}
+
+	h := recipe.Hops[0]
+	if math.Abs(h.Amount-1.975) > 1e-3 || h.Alpha != 5 || h.Time != 60 || h.Form != "leaf" || h.Use != "boil" {
+		t.Error(h)
+	}
+
+	if y := recipe.Yeasts[0]; y.Attenuation != 73 || y.Type != "ale" || y.Form != "liquid" {
+		t.Error(y)
+	}
+
+	step := recipe.MashSteps[0]
+	if step.Temperature != 66 || !step.Metric || step.Time != 60 || step.Name != "sacch" || step.Type != "infusion" {
+		t.Error(step)
+	}
+
+	if recipe.Type != "all grain" || recipe.Author != "cswank" {
+		t.Error(recipe.Type, recipe.Author)
+	}
+}
+
+func TestBeerJSONGravityUnits(t *testing.T) {
+	doc := `{"beerjson": {"version": 1, "recipes": [{"name": "stout", "batch_size": {"unit": "gal", "value": 5}, "ingredients": {"fermentable_additions": [
+  {"name": "extract", "yield": {"potential": {"unit": "%s", "value": %g}}, "color": {"unit": "SRM", "value": 2}, "amount": {"unit": "lb", "value": 1}}
+]}}]}}`
+
+	recipe, err := recipes.NewBeerJSON(strings.NewReader(fmt.Sprintf(doc, "plato", 10.0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ppg := recipe.Fermentables[0].PPG; math.Abs(ppg-40.0) > 0.1 {
+		t.Error(ppg)
+	}
+
+	if _, err := recipes.NewBeerJSON(strings.NewReader(fmt.Sprintf(doc, "ppg", 40.0))); err == nil {
+		t.Error("expected an error for unknown gravity units")
+	}
+}
+
+func TestBeerJSONRoundTrip(t *testing.T) {
+	f, err := os.Open("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	recipe, err := recipes.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipe.Hops[0].Form = "pellet"
+	recipe.Hops[0].Use = "boil"
+	recipe.Hops[4].Use = "fermentation"
+	recipe.Yeasts[0].Type = "ale"
+	recipe.MashSteps[1].Metric = true
+
+	var buf bytes.Buffer
+	if err := recipe.WriteBeerJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	//the required fields are always there, and nothing else is
+	//made up
+	doc := buf.String()
+	for _, s := range []string{`"type": "all grain"`, `"author": ""`, `"name": "mash"`, `"name": "step 1"`, `"type": "infusion"`, `"use": "add_to_fermentation"`} {
+		if !strings.Contains(doc, s) {
+			t.Error(s)
+		}
+	}
+	for _, s := range []string{`"grain_temperature"`, `"liquid"`} {
+		if strings.Contains(doc, s) {
+			t.Error(s)
+		}
+	}
+
+	out, err := recipes.NewBeerJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range out.Fermentables {
+		if math.Abs(out.Fermentables[i].PPG-recipe.Fermentables[i].PPG) > 1e-9 {
+			t.Error(out.Fermentables[i])
+		}
+		out.Fermentables[i].PPG = recipe.Fermentables[i].PPG
+	}
+
+	recipe.Type = "all grain"
+	for i := range recipe.MashSteps {
+		recipe.MashSteps[i].Name = fmt.Sprintf("step %d", i+1)
+		recipe.MashSteps[i].Type = "infusion"
+	}
+	if !reflect.DeepEqual(out, recipe) {
+		t.Errorf("%+v != %+v", out, recipe)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var buf bytes.Buffer
+	for _, pth := range []string{"example.json", "example.xml", "beerjson"} {
+		var r io.Reader
+		if pth == "beerjson" {
+			r = &buf
+		} else {
+			f, err := os.Open(pth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		recipe, err := recipes.Load(r)
+		if err != nil {
+			t.Fatal(pth, err)
+		}
+
+		if recipe.Name != "Vladimir's Own Stout" || len(recipe.Hops) != 5 {
+			t.Error(pth, recipe)
+		}
+
+		if buf.Len() == 0 {
+			if err := recipe.WriteBeerJSON(&buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := recipes.Load(strings.NewReader("name: stout"))
+	if err != recipes.ErrUnknownFormat {
+		t.Error(err)
+	}
+
+	_, err = recipes.Load(strings.NewReader(`<RECIPES><RECIPE><NAME>stout</RECIPE>`))
+	var de *recipes.DecodeError
+	if !errors.As(err, &de) || de.Format != recipes.BeerXML {
+		t.Error(err)
+	}
+
+	_, err = recipes.Load(strings.NewReader(`{"beerjson": {"version": 1, "recipes": [{"name": "stout", "batch_size": {"unit": "furlongs", "value": 1}}]}}`))
+	if !errors.As(err, &de) || de.Format != recipes.BeerJSON {
+		t.Error(err)
+	}
+
+	_, err = recipes.Load(strings.NewReader(`{"name": "stout", "batch_size": "five"}`))
+	if !errors.As(err, &de) || de.Format != recipes.Brewtoad {
+		t.Error(err)
+	}
+}
+
+func TestGravity(t *testing.T) {
+	f, err := os.Open("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	recipe, err := recipes.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the example was exported with an og of 1.088, fg of 1.02
+	//and abv of 8.9
+	if og := recipe.OG(); math.Abs(og-1.08895) > 1e-4 {
+		t.Error(og)
+	}
+	if fg := recipe.FG(); math.Abs(fg-1.02046) > 1e-4 {
+		t.Error(fg)
+	}
+	if abv := recipe.ABV(); math.Abs(abv-8.98) > 0.01 {
+		t.Error(abv)
+	}
+
+	recipe.Fermentables = []recipes.Fermentable{{Amount: 160, Unit: "oz", PPG: 37}}
+	recipe.Efficiency = 0
+	recipe.Yeasts = nil
+	if og := recipe.OG(); math.Abs(og-1.0555) > 1e-9 {
+		t.Error(og)
+	}
+	if fg := recipe.FG(); math.Abs(fg-1.013875) > 1e-9 {
+		t.Error(fg)
+	}
+}
+
+func TestIBU(t *testing.T) {
+	f, err := os.Open("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	recipe, err := recipes.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := recipe.Hops[4]; h.Use != "fermentation" || h.Form != "pellet" {
+		t.Fatal(h)
+	}
+
+	//1oz of 14% Zeus pellets boiled for 55 minutes in wort of
+	//1.071, the last Cascade is a dry hop (for 14 days)
+	tinseth := recipe.HopIBUs(recipes.Tinseth)
+	if len(tinseth) != 5 || math.Abs(tinseth[0]-1.1*39.114) > 1e-3 || tinseth[4] != 0 {
+		t.Error(tinseth)
+	}
+	if ibu := recipe.IBU(recipes.Tinseth); math.Abs(ibu-102.116) > 1e-3 {
+		t.Error(ibu)
+	}
+
+	rager := recipe.HopIBUs(recipes.Rager)
+	if math.Abs(rager[0]-1.1*56.971) > 1e-3 || rager[4] != 0 {
+		t.Error(rager)
+	}
+	if ibu := recipe.IBU(recipes.Rager); math.Abs(ibu-120.218) > 1e-3 {
+		t.Error(ibu)
+	}
+
+	//the BeerXML export of the same recipe is just as bitter
+	//(its yields round to a slightly different ppg)
+	x, err := os.Open("example.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+
+	xml, err := recipes.NewBeerXML(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ibu := xml.IBU(recipes.Tinseth); math.Abs(ibu-102.116) > 0.05 {
+		t.Error(ibu)
+	}
+
+	recipe.Hops[0].Form = "leaf"
+	if ibu := recipe.HopIBUs(recipes.Tinseth)[0]; math.Abs(ibu-tinseth[0]/1.1) > 1e-9 {
+		t.Error(ibu)
+	}
+
+	//without a use, a hop that is in for longer than the boil
+	//isn't boiled
+	recipe.Hops[0].Use = ""
+	recipe.Hops[0].Time = 7 * 24 * 60
+	if ibu := recipe.HopIBUs(recipes.Tinseth)[0]; ibu != 0 {
+		t.Error(ibu)
+	}
+
+	//a bigger boil is a lower gravity, which is more bitter
+	recipe.Hops[0].Time = 55
+	recipe.BoilSize = 8
+	if ibu := recipe.HopIBUs(recipes.Tinseth)[0]; ibu <= tinseth[0]/1.1 {
+		t.Error(ibu)
+	}
+}
@@ -0,0 +1,76 @@
+package recipes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sucrosePPG is the points per pound per gallon of sucrose,
+// which a fermentable's yield (%) is relative to.
+const sucrosePPG = 46.214
+
+// lbPer is how many lb are in one of each of the BeerJSON
+// mass units.
+var lbPer = map[string]float64{
+	"mg": 1.0 / 453592.37,
+	"g":  1.0 / 453.59237,
+	"kg": kgToLB,
+	"lb": 1.0,
+	"oz": 1.0 / 16.0,
+}
+
+// gallonsPer is how many (US) gallons are in one of each of
+// the BeerJSON volume units.
+var gallonsPer = map[string]float64{
+	"ml":    1.0 / 3785.41178,
+	"l":     1.0 / litersPerGal,
+	"tsp":   1.0 / 768.0,
+	"tbsp":  1.0 / 256.0,
+	"floz":  1.0 / 128.0,
+	"cup":   1.0 / 16.0,
+	"pt":    1.0 / 8.0,
+	"qt":    1.0 / 4.0,
+	"gal":   1.0,
+	"bbl":   31.0,
+	"ifloz": 1.20095 / 160.0,
+	"ipt":   1.20095 / 8.0,
+	"iqt":   1.20095 / 4.0,
+	"igal":  1.20095,
+	"ibbl":  43.2342,
+}
+
+// minutesPer is how many minutes are in one of each of the
+// BeerJSON time units.
+var minutesPer = map[string]float64{
+	"sec":  1.0 / 60.0,
+	"min":  1.0,
+	"hr":   60.0,
+	"day":  1440.0,
+	"week": 10080.0,
+}
+
+// lovibond converts a color in Lovibond, SRM or EBC to
+// Lovibond, which is what a Fermentable's Color is.
+func lovibond(q quantity) (float64, error) {
+	switch strings.ToLower(q.Unit) {
+	case "lovi":
+		return q.Value, nil
+	case "srm":
+		return (q.Value + 0.76) / 1.3546, nil
+	case "ebc":
+		return (q.Value/1.97 + 0.76) / 1.3546, nil
+	}
+	return 0, fmt.Errorf("unknown color units %q", q.Unit)
+}
+
+// specificGravity converts a gravity in sg, Plato or Brix to
+// sg, which is what a fermentable's potential is.
+func specificGravity(q quantity) (float64, error) {
+	switch strings.ToLower(q.Unit) {
+	case "sg":
+		return q.Value, nil
+	case "plato", "brix":
+		return 1.0 + q.Value/(258.6-q.Value/258.2*227.1), nil
+	}
+	return 0, fmt.Errorf("unknown gravity units %q", q.Unit)
+}
@@ -0,0 +1,633 @@
+package brewery
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cswank/gogadgets"
+)
+
+const (
+	//defaults for the simulated brewery, power is W and
+	//rates are ml/s.
+	simMainsRate    = 150.0
+	simHeaterWatts  = 5500.0
+	simCoolerWatts  = -4000.0
+	simTick         = 100 * time.Millisecond
+	simPublishEvery = time.Second
+)
+
+// Simulator stands in for the hardware of a brewery so that
+// recipe methods can be rehearsed without any water.  Valves
+// and pumps move water with the transfers' flow models (the
+// mains fill at a fixed rate), heaters warm their vessel with
+// the vessel's ThermalModel, and the level switches, flow meters
+// and thermometers report what the simulated water is doing.
+// Scale speeds everything up, a Scale of 60 runs an hour of
+// brewing in a minute.
+//
+// The "wait for" steps of a method are timed by gogadgets, so
+// a method has to be sped up with Steps.
+type Simulator struct {
+	lock    sync.Mutex
+	scale   float64
+	started time.Time
+	last    time.Duration
+
+	vessels   map[string]*simVessel
+	transfers map[string]*simTransfer
+	switches  []*simSwitch
+	pressures []*simPressure
+	outputs   []*simOutput
+	inputs    []*simThermometer
+	kFactor   float64
+}
+
+type simVessel struct {
+	thermal     ThermalModel
+	volume      float64
+	temperature float64
+}
+
+type simTransfer struct {
+	Transfer
+	flow   FlowModel
+	open   bool
+	opened time.Duration
+	start  float64
+	moved  float64
+	meter  *simPoller
+	pulses float64
+}
+
+type simSwitch struct {
+	LevelSwitch
+	vessel string
+	above  bool
+	poller *simPoller
+}
+
+// NewSimulator simulates the brewery declared by cfg along
+// with the gadgets from a gogadgets config.
+func NewSimulator(cfg *Config, gadgets []gogadgets.GadgetConfig, scale float64) (*Simulator, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("invalid simulation scale %f", scale)
+	}
+
+	top, err := cfg.topology()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		scale:     scale,
+		vessels:   map[string]*simVessel{},
+		transfers: map[string]*simTransfer{},
+		kFactor:   cfg.FlowMeterKFactor,
+	}
+
+	for _, v := range top.Vessels {
+		m := v.Thermal.withDefaults()
+		s.vessels[v.Name] = &simVessel{thermal: m, temperature: m.Ambient}
+		for _, sw := range vesselSwitches(cfg, v) {
+			s.switches = append(s.switches, &simSwitch{LevelSwitch: sw, vessel: v.Name, poller: newSimPoller()})
+		}
+		if v.Pressure != nil && v.Geometry != nil {
+			s.pressures = append(s.pressures, &simPressure{sim: s, vessel: v.Name, cfg: *v.Pressure, geometry: *v.Geometry})
+		}
+	}
+
+	for _, t := range top.Transfers {
+		st := &simTransfer{Transfer: t}
+		if t.From != "" {
+			if st.flow, err = newFlowModel(t.Flow); err != nil {
+				return nil, err
+			}
+		}
+		if t.Meter != "" {
+			st.meter = newSimPoller()
+		}
+		s.transfers[t.Gadget] = st
+	}
+
+	for _, g := range gadgets {
+		uid := fmt.Sprintf("%s %s", g.Location, g.Name)
+		//gogadgets turns outputs on and off with these when
+		//the config doesn't say otherwise.
+		if g.OnCommand == "" {
+			g.OnCommand = fmt.Sprintf("turn on %s", uid)
+		}
+		if g.OffCommand == "" {
+			g.OffCommand = fmt.Sprintf("turn off %s", uid)
+		}
+		switch g.Pin.Type {
+		case "thermometer":
+			s.inputs = append(s.inputs, &simThermometer{sim: s, cfg: g, uid: uid})
+		case "heater":
+			def := simHeaterWatts
+			if v, ok := s.vessels[g.Location]; ok && v.thermal.Watts > 0 {
+				def = v.thermal.Watts
+			}
+			s.outputs = append(s.outputs, &simOutput{sim: s, cfg: g, uid: uid, watts: pinWatts(g.Pin, def)})
+		case "cooler":
+			s.outputs = append(s.outputs, &simOutput{sim: s, cfg: g, uid: uid, watts: pinWatts(g.Pin, simCoolerWatts)})
+		case "gpio":
+			s.outputs = append(s.outputs, &simOutput{sim: s, cfg: g, uid: uid})
+		}
+	}
+
+	return s, nil
+}
+
+// pinWatts is the wattage from a gadget's pin args, as in
+// "args": {"watts": 5500}.  Heaters default to the wattage in
+// their vessel's ThermalModel.
+func pinWatts(pin gogadgets.Pin, def float64) float64 {
+	if w, ok := pin.Args["watts"].(float64); ok {
+		return w
+	}
+	return def
+}
+
+var waitFor = regexp.MustCompile(`^wait for ([0-9.]+) (seconds?|minutes?|hours?)$`)
+
+// Steps speeds up the "wait for <n> seconds|minutes|hours"
+// steps of a method to match the scale of the simulation.
+func (s *Simulator) Steps(steps []string) []string {
+	out := make([]string, len(steps))
+	for i, step := range steps {
+		out[i] = step
+		m := waitFor.FindStringSubmatch(step)
+		if m == nil {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		out[i] = fmt.Sprintf("wait for %g %s", n/s.scale, m[2])
+	}
+	return out
+}
+
+// Options replace the volume manager's clock and gpio with
+// the simulated ones.
+func (s *Simulator) Options() []func(*volumeManager) {
+	opts := []func(*volumeManager){
+		WithAfter(s.after),
+		WithNewTimer(func() Timer { return &simTimer{sim: s} }),
+	}
+
+	for _, sw := range s.switches {
+		opts = append(opts, WithLevelSwitch(sw.Pin, sw.poller))
+	}
+
+	for _, t := range s.transfers {
+		if t.meter != nil {
+			opts = append(opts, WithFlowMeter(t.Gadget, t.meter))
+		}
+	}
+
+	for _, p := range s.pressures {
+		opts = append(opts, WithPressureSensor(p.vessel, p))
+	}
+	return opts
+}
+
+// Gadgets are the simulated stand-ins for the gadgets in the
+// gogadgets config.
+func (s *Simulator) Gadgets() []gogadgets.Gadgeter {
+	var out []gogadgets.Gadgeter
+	for _, o := range s.outputs {
+		out = append(out, o)
+	}
+	for _, i := range s.inputs {
+		out = append(out, i)
+	}
+	return out
+}
+
+// Start runs the simulation, it doesn't return.
+func (s *Simulator) Start() {
+	s.lock.Lock()
+	s.started = time.Now()
+	s.lock.Unlock()
+	for {
+		time.Sleep(simTick)
+		s.lock.Lock()
+		now := s.now()
+		s.step(now, now-s.last)
+		s.last = now
+		s.lock.Unlock()
+	}
+}
+
+// now is the simulated time since the simulation started.
+func (s *Simulator) now() time.Duration {
+	if s.started.IsZero() {
+		return 0
+	}
+	return time.Duration(float64(time.Since(s.started)) * s.scale)
+}
+
+// timestamp is the simulated time of day, for the messages
+// the simulated gadgets send.
+func (s *Simulator) timestamp() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started.IsZero() {
+		return time.Now().UTC()
+	}
+	return s.started.Add(s.now()).UTC()
+}
+
+func (s *Simulator) after(d time.Duration) <-chan time.Time {
+	return time.After(time.Duration(float64(d) / s.scale))
+}
+
+func (s *Simulator) step(now, dt time.Duration) {
+	for _, t := range s.transfers {
+		if t.open {
+			s.flow(t, now, dt)
+		}
+	}
+
+	watts := map[string]float64{}
+	for _, o := range s.outputs {
+		if o.heating() {
+			watts[o.cfg.Location] += o.watts
+		}
+	}
+
+	for k, v := range s.vessels {
+		v.temperature = v.thermal.Step(v.volume, v.temperature, watts[k], dt)
+		v.volume -= v.thermal.Evaporated(v.volume, v.temperature, watts[k], dt)
+	}
+
+	for _, sw := range s.switches {
+		v := s.vessels[sw.vessel]
+		above := v.volume > sw.Volume*gallonsToML || (sw.Volume > 0 && v.volume == sw.Volume*gallonsToML)
+		if above == sw.above {
+			continue
+		}
+
+		sw.above = above
+		if sw.Edge == "" || sw.Edge == "both" || (sw.Edge == "rising") == above {
+			sw.poller.push(above)
+		}
+	}
+}
+
+// flow moves the water of an open transfer.  The mains fill
+// at a fixed rate, everything else uses the transfer's flow
+// model.
+func (s *Simulator) flow(t *simTransfer, now, dt time.Duration) {
+	to := s.vessels[t.To]
+	if t.From == "" {
+		mix(to, simMainsRate*dt.Seconds(), to.thermal.Ambient)
+		return
+	}
+
+	from := s.vessels[t.From]
+	vol := math.Max(0, math.Min(t.flow.Volume(now-t.opened, t.start), t.start))
+	delta := math.Min(vol-t.moved, from.volume)
+	if delta <= 0 {
+		return
+	}
+
+	from.volume -= delta
+	mix(to, delta, from.temperature)
+	t.moved += delta
+
+	if t.meter != nil && s.kFactor > 0 {
+		t.pulses += delta / 1000.0 * s.kFactor
+		for ; t.pulses >= 1; t.pulses-- {
+			t.meter.push(true)
+		}
+	}
+}
+
+// mix adds ml of water at temperature to a vessel.
+func mix(v *simVessel, ml, temperature float64) {
+	if v.volume+ml > 0 {
+		v.temperature = (v.volume*v.temperature + ml*temperature) / (v.volume + ml)
+	}
+	v.volume += ml
+}
+
+func (s *Simulator) setOutput(uid string, on bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, ok := s.transfers[uid]
+	if !ok || t.open == on {
+		return
+	}
+
+	t.open = on
+	if on && t.From != "" {
+		t.opened = s.now()
+		t.start = s.vessels[t.From].volume
+		t.moved = 0
+	}
+}
+
+func (s *Simulator) temperature(vessel string) (float64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, ok := s.vessels[vessel]
+	if !ok {
+		return 0, false
+	}
+	return v.temperature, true
+}
+
+// simTimer measures simulated time.
+type simTimer struct {
+	sim   *Simulator
+	start time.Duration
+}
+
+func (t *simTimer) Start() {
+	t.sim.lock.Lock()
+	t.start = t.sim.now()
+	t.sim.lock.Unlock()
+}
+
+func (t *simTimer) Since() time.Duration {
+	t.sim.lock.Lock()
+	defer t.sim.lock.Unlock()
+	return t.sim.now() - t.start
+}
+
+// simPressure stands in for the pressure sensor of a vessel.
+type simPressure struct {
+	sim      *Simulator
+	vessel   string
+	cfg      PressureConfig
+	geometry Geometry
+}
+
+func (p *simPressure) Pressure() (float64, error) {
+	p.sim.lock.Lock()
+	ml := p.sim.vessels[p.vessel].volume
+	p.sim.lock.Unlock()
+
+	sg := p.cfg.Gravity
+	if sg == 0 {
+		sg = 1.0
+	}
+	h := math.Max(0, p.geometry.Level(ml)-p.cfg.Offset)
+	return h * sg * standardGravity / 100.0, nil
+}
+
+// simPoller stands in for the gpio of a level switch or flow
+// meter.  Wait returns once for every edge that was pushed.
+type simPoller struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	edges []bool
+}
+
+func newSimPoller() *simPoller {
+	p := &simPoller{}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+func (p *simPoller) push(v bool) {
+	p.lock.Lock()
+	p.edges = append(p.edges, v)
+	p.lock.Unlock()
+	p.cond.Signal()
+}
+
+func (p *simPoller) Wait() (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for len(p.edges) == 0 {
+		p.cond.Wait()
+	}
+	v := p.edges[0]
+	p.edges = p.edges[1:]
+	return v, nil
+}
+
+// simOutput stands in for a valve, pump, heater or cooler.  It
+// understands the same on and off commands as the gadget in
+// the gogadgets config, including targets like "heat hlt to
+// 170 F" or "fill tun to 3.2 gallons".
+type simOutput struct {
+	sim   *Simulator
+	cfg   gogadgets.GadgetConfig
+	uid   string
+	watts float64
+	out   chan<- gogadgets.Message
+
+	lock        sync.Mutex
+	on          bool
+	target      float64
+	targetName  string
+	targetReach bool
+}
+
+func (o *simOutput) GetUID() string {
+	return o.uid
+}
+
+func (o *simOutput) GetDirection() string {
+	return "output"
+}
+
+func (o *simOutput) Start(in <-chan gogadgets.Message, out chan<- gogadgets.Message) {
+	o.out = out
+	o.sendUpdate()
+	for msg := range in {
+		o.readMessage(msg)
+	}
+}
+
+// heating is true when a heater (or cooler) is on and hasn't
+// reached its target temperature.
+func (o *simOutput) heating() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.watts != 0 && o.on && !o.targetReach
+}
+
+func (o *simOutput) readMessage(msg gogadgets.Message) {
+	switch {
+	case msg.Type == "command" && msg.Body == "update":
+		o.sendUpdate()
+	case msg.Type == "command" && msg.Body == o.cfg.OnCommand:
+		o.setTarget("", 0)
+		o.set(true)
+	case msg.Type == "command" && strings.HasPrefix(msg.Body, o.cfg.OnCommand+" to "):
+		if err := o.parseTarget(strings.TrimPrefix(msg.Body, o.cfg.OnCommand+" to ")); err == nil {
+			o.set(true)
+		}
+	case msg.Type == "command" && msg.Body == o.cfg.OffCommand:
+		o.set(false)
+	case msg.Type == "update" && msg.Location == o.cfg.Location:
+		o.checkTarget(msg)
+	}
+}
+
+func (o *simOutput) parseTarget(s string) error {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid target %q", s)
+	}
+
+	val, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToUpper(parts[1]) == "F" || strings.ToUpper(parts[1]) == "C" {
+		o.setTarget("temperature", toCelsius(val, parts[1]))
+		return nil
+	}
+
+	ml, err := toML(val, parts[1])
+	if err != nil {
+		return err
+	}
+	o.setTarget("volume", ml)
+	return nil
+}
+
+func (o *simOutput) setTarget(name string, val float64) {
+	o.lock.Lock()
+	o.targetName, o.target, o.targetReach = name, val, false
+	o.lock.Unlock()
+}
+
+// checkTarget watches the updates from the gadget's location.
+// Valves and pumps turn off at their target volume, heaters
+// and coolers stay on but stop heating at their target.
+func (o *simOutput) checkTarget(msg gogadgets.Message) {
+	o.lock.Lock()
+	name, target, on := o.targetName, o.target, o.on
+	o.lock.Unlock()
+
+	val, ok := msg.Value.Value.(float64)
+	if !on || !ok || name == "" || msg.Name != name {
+		return
+	}
+
+	switch name {
+	case "volume":
+		ml, err := toML(val, msg.Value.Units)
+		if err == nil && ml >= target {
+			o.set(false)
+		}
+	case "temperature":
+		c := toCelsius(val, msg.Value.Units)
+		reached := (o.watts > 0 && c >= target) || (o.watts < 0 && c <= target)
+		o.lock.Lock()
+		o.targetReach = reached
+		o.lock.Unlock()
+	}
+}
+
+func (o *simOutput) set(on bool) {
+	o.lock.Lock()
+	changed := o.on != on
+	o.on = on
+	o.lock.Unlock()
+
+	if changed {
+		o.sim.setOutput(o.uid, on)
+		o.sendUpdate()
+	}
+}
+
+func (o *simOutput) sendUpdate() {
+	o.lock.Lock()
+	on := o.on
+	o.lock.Unlock()
+
+	o.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    o.uid,
+		Location:  o.cfg.Location,
+		Name:      o.cfg.Name,
+		Type:      "update",
+		Timestamp: o.sim.timestamp(),
+		Value: gogadgets.Value{
+			Value: on,
+		},
+		Info: gogadgets.Info{
+			Direction: "output",
+			On:        []string{o.cfg.OnCommand},
+			Off:       []string{o.cfg.OffCommand},
+		},
+	}
+}
+
+// simThermometer reports the simulated temperature of its
+// vessel every second.
+type simThermometer struct {
+	sim *Simulator
+	cfg gogadgets.GadgetConfig
+	uid string
+	out chan<- gogadgets.Message
+}
+
+func (t *simThermometer) GetUID() string {
+	return t.uid
+}
+
+func (t *simThermometer) GetDirection() string {
+	return "input"
+}
+
+func (t *simThermometer) Start(in <-chan gogadgets.Message, out chan<- gogadgets.Message) {
+	t.out = out
+	t.sendUpdate()
+	for {
+		select {
+		case msg := <-in:
+			if msg.Type == "command" && msg.Body == "update" {
+				t.sendUpdate()
+			}
+		case <-time.After(simPublishEvery):
+			t.sendUpdate()
+		}
+	}
+}
+
+func (t *simThermometer) sendUpdate() {
+	c, ok := t.sim.temperature(t.cfg.Location)
+	if !ok {
+		return
+	}
+
+	units := t.cfg.Pin.Units
+	if units == "" {
+		units = "C"
+	}
+
+	t.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    t.uid,
+		Location:  t.cfg.Location,
+		Name:      t.cfg.Name,
+		Type:      "update",
+		Timestamp: t.sim.timestamp(),
+		Value: gogadgets.Value{
+			Value: fromCelsius(c, units),
+			Units: units,
+		},
+		Info: gogadgets.Info{
+			Direction: "input",
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package brewery_test
+
+import (
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulator", func() {
+	var (
+		sim     *brewery.Simulator
+		b       *brewery.Brewery
+		gadgets map[string]gogadgets.Gadgeter
+		in      map[string]chan gogadgets.Message
+		out     map[string]chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		cfg := &brewery.Config{
+			HLTCapacity:    1.0,
+			FloatSwitchPin: "7",
+		}
+
+		var err error
+		sim, err = brewery.NewSimulator(cfg, []gogadgets.GadgetConfig{
+			{
+				Location:   "hlt",
+				Name:       "valve",
+				OnCommand:  "fill hlt",
+				OffCommand: "stop filling hlt",
+				Pin:        gogadgets.Pin{Type: "gpio", Pin: "11"},
+			},
+			{
+				Location:   "hlt",
+				Name:       "heater",
+				OnCommand:  "heat hlt",
+				OffCommand: "stop heating hlt",
+				Pin:        gogadgets.Pin{Type: "heater", Pin: "12"},
+			},
+			{
+				Location: "brewery",
+				Name:     "fan",
+				Pin:      gogadgets.Pin{Type: "gpio", Pin: "13"},
+			},
+			{
+				Location: "hlt",
+				Name:     "temperature",
+				Pin:      gogadgets.Pin{Type: "thermometer", Units: "C"},
+			},
+		}, 600)
+		Expect(err).To(BeNil())
+
+		b, err = brewery.New(cfg, sim.Options()...)
+		Expect(err).To(BeNil())
+
+		gadgets = map[string]gogadgets.Gadgeter{"hlt volume": b.Tank("hlt")}
+		for _, g := range sim.Gadgets() {
+			gadgets[g.GetUID()] = g
+		}
+
+		in = map[string]chan gogadgets.Message{}
+		out = map[string]chan gogadgets.Message{}
+		for uid, g := range gadgets {
+			in[uid] = make(chan gogadgets.Message, 100)
+			out[uid] = make(chan gogadgets.Message, 100)
+			go g.Start(out[uid], in[uid])
+		}
+
+		go sim.Start()
+	})
+
+	//next returns the next update from a gadget that matches f.
+	next := func(uid string, f func(gogadgets.Message) bool) gogadgets.Message {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case msg := <-in[uid]:
+				if f(msg) {
+					return msg
+				}
+			case <-timeout:
+				Fail("timed out waiting for " + uid)
+			}
+		}
+	}
+
+	It("speeds up the waits of a method", func() {
+		steps := sim.Steps([]string{"wait for 60.000000 minutes", "heat hlt to 170 F", "wait for 30 seconds", "wait for user to add grains"})
+		Expect(steps).To(Equal([]string{"wait for 0.1 minutes", "heat hlt to 170 F", "wait for 0.05 seconds", "wait for user to add grains"}))
+	})
+
+	It("fills the hlt until the float switch trips", func() {
+		out["hlt valve"] <- gogadgets.Message{Type: "command", Body: "fill hlt"}
+		msg := next("hlt valve", func(m gogadgets.Message) bool { return m.Value.Value == true })
+
+		//the valve's update goes to the bus, which passes it on
+		//to the tanks.
+		out["hlt volume"] <- msg
+		msg = next("hlt volume", func(m gogadgets.Message) bool { return m.Value.Value.(float64) > 0 })
+		Expect(msg.Value.Value.(float64)).To(Equal(1.0))
+	})
+
+	It("heats the hlt", func() {
+		out["hlt heater"] <- gogadgets.Message{Type: "command", Body: "heat hlt"}
+		msg := next("hlt temperature", func(m gogadgets.Message) bool { return m.Value.Value.(float64) > 30 })
+		Expect(msg.Value.Units).To(Equal("C"))
+	})
+
+	It("turns outputs on and off with the default commands", func() {
+		out["brewery fan"] <- gogadgets.Message{Type: "command", Body: "turn on brewery fan"}
+		next("brewery fan", func(m gogadgets.Message) bool { return m.Value.Value == true })
+
+		out["brewery fan"] <- gogadgets.Message{Type: "command", Body: "turn off brewery fan"}
+		next("brewery fan", func(m gogadgets.Message) bool { return m.Value.Value == false })
+	})
+
+	It("stamps updates with the simulated time", func() {
+		first := next("hlt temperature", func(gogadgets.Message) bool { return true })
+
+		//100 ms at 600 times speed is a minute
+		time.Sleep(100 * time.Millisecond)
+		out["hlt temperature"] <- gogadgets.Message{Type: "command", Body: "update"}
+		next("hlt temperature", func(m gogadgets.Message) bool { return m.Timestamp.Sub(first.Timestamp) > 30*time.Second })
+	})
+})
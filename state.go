@@ -0,0 +1,95 @@
+package brewery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultStateTimeout = 12 * time.Hour
+)
+
+// state is the snapshot of the vessel volumes (ml) and their
+// uncertainties that is written to the state file, along with
+// the overshoot (ml) learned for each transfer.
+type state struct {
+	Saved         time.Time          `json:"saved"`
+	Volumes       map[string]float64 `json:"volumes"`
+	Uncertainties map[string]float64 `json:"uncertainties,omitempty"`
+	Overshoots    map[string]float64 `json:"overshoots,omitempty"`
+}
+
+// stateFile keeps the volumes across restarts, so a crash
+// in the middle of a brew doesn't lose track of the water.
+type stateFile struct {
+	path    string
+	timeout time.Duration
+}
+
+func newStateFile(cfg *Config) *stateFile {
+	if cfg.StateFile == "" {
+		return nil
+	}
+
+	timeout := cfg.StateTimeout
+	if timeout == 0 {
+		timeout = defaultStateTimeout
+	}
+
+	return &stateFile{path: cfg.StateFile, timeout: timeout}
+}
+
+// load returns the saved state.  The volumes are dropped if
+// they were saved longer than timeout ago.
+func (s *stateFile) load() (*state, error) {
+	var st state
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return &st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&st); err != nil {
+		return nil, err
+	}
+
+	if time.Since(st.Saved) > s.timeout {
+		st.Volumes = nil
+		st.Uncertainties = nil
+	}
+
+	return &st, nil
+}
+
+// save writes to a temporary file and renames it so a crash
+// while saving can't leave a half written state file.
+func (s *stateFile) save(st state) error {
+	st.Saved = time.Now()
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,81 @@
+package brewery_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State file", func() {
+	var (
+		dir string
+		cfg *brewery.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "brewery")
+		Expect(err).To(BeNil())
+
+		cfg = &brewery.Config{
+			HLTCapacity: 7.0,
+			StateFile:   filepath.Join(dir, "state.json"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	start := func(b *brewery.Brewery, name string) (chan gogadgets.Message, chan gogadgets.Message) {
+		in := make(chan gogadgets.Message)
+		out := make(chan gogadgets.Message)
+		go b.Tank(name).Start(out, in)
+		return out, in
+	}
+
+	It("restores the volumes after a restart", func() {
+		pollTrigger := make(chan bool)
+		b, err := brewery.New(cfg, brewery.WithPoller(&FakePoller{trigger: pollTrigger}))
+		Expect(err).To(BeNil())
+
+		out, in := start(b, "hlt")
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+
+		out <- gogadgets.Message{
+			Type:   "update",
+			Sender: "hlt valve",
+			Value: gogadgets.Value{
+				Value: true,
+			},
+		}
+		pollTrigger <- true
+		msg = <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(7.0))
+
+		b, err = brewery.New(cfg, brewery.WithPoller(&FakePoller{}))
+		Expect(err).To(BeNil())
+		_, in = start(b, "hlt")
+		msg = <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(7.0))
+	})
+
+	It("ignores stale volumes", func() {
+		saved := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+		err := ioutil.WriteFile(cfg.StateFile, []byte(`{"saved": "`+saved+`", "volumes": {"hlt": 26497.87}}`), 0644)
+		Expect(err).To(BeNil())
+
+		b, err := brewery.New(cfg, brewery.WithPoller(&FakePoller{}))
+		Expect(err).To(BeNil())
+		_, in := start(b, "hlt")
+		msg := <-in
+		Expect(msg.Value.Value.(float64)).To(Equal(0.0))
+	})
+})
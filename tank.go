@@ -2,6 +2,7 @@ package brewery
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/cswank/gogadgets"
@@ -11,28 +12,94 @@ type Tank struct {
 	master bool
 	name   string
 	uid    string
+	units  string
+	vol    *volumeManager
 	out    chan<- gogadgets.Message
+
+	//wake is how the volume manager tells the tank there is
+	//something to publish.
+	wake chan struct{}
+
+	//uncertainty (ml) is the last one that was published.
+	uncertainty float64
+
+	//geometry lets the tank publish the usable volume and the
+	//level of the liquid along with the volume.
+	geometry *Geometry
+
+	//thermal predicts how long it takes to reach target (C)
+	//from the temperature reported by the vessel's thermometer.
+	thermal     ThermalModel
+	temperature *float64
+	target      *float64
 }
 
 func masterTank(t *Tank) {
 	t.master = true
 }
 
-func NewTank(name string, opts ...func(*Tank)) *Tank {
-	t := &Tank{name: name, uid: fmt.Sprintf("%s volume", name)}
+func tankUnits(units string) func(*Tank) {
+	return func(t *Tank) {
+		t.units = units
+	}
+}
+
+func tankThermal(m ThermalModel) func(*Tank) {
+	return func(t *Tank) {
+		t.thermal = m
+	}
+}
+
+func tankGeometry(g *Geometry) func(*Tank) {
+	return func(t *Tank) {
+		t.geometry = g
+	}
+}
+
+func newTank(vol *volumeManager, name string, opts ...func(*Tank)) *Tank {
+	t := &Tank{
+		name:  name,
+		uid:   fmt.Sprintf("%s volume", name),
+		vol:   vol,
+		units: gallons,
+		wake:  make(chan struct{}, 1),
+	}
+
 	for _, f := range opts {
 		f(t)
 	}
-	vol.register(name, t.sendUpdate)
+	vol.register(name, t.wake, t.master)
 	return t
 }
 
 func (t *Tank) Start(input <-chan gogadgets.Message, out chan<- gogadgets.Message) {
 	t.out = out
-	t.sendUpdate(vol.get(t.name))
+	t.publish(true)
 	for {
-		msg := <-input
-		t.readMessage(msg)
+		select {
+		case msg := <-input:
+			t.readMessage(msg)
+		case <-t.wake:
+			t.publish(false)
+		}
+	}
+}
+
+// publish sends the tank's volume if it has changed (or
+// always is set) and its uncertainty if that has changed,
+// followed by any commands the volume manager wants sent.
+func (t *Tank) publish(always bool) {
+	ml, u, changed, cmds := t.vol.pending(t.name)
+	if always || changed {
+		t.sendUpdate(ml)
+	}
+
+	if u != t.uncertainty {
+		t.sendUncertainty(u)
+	}
+
+	for _, c := range cmds {
+		t.sendCommand(c)
 	}
 }
 
@@ -46,26 +113,159 @@ func (t *Tank) GetUID() string {
 
 func (t *Tank) readMessage(msg gogadgets.Message) {
 	if msg.Type == "command" && msg.Body == "update" {
-		t.sendUpdate(vol.get(t.name))
-	} else if t.master {
-		vol.readMessage(msg)
+		t.sendUpdate(t.vol.get(t.name))
+		t.sendUncertainty(t.vol.uncertainty(t.name))
+	} else if msg.Type == "command" {
+		t.readCommand(msg.Body)
+	} else {
+		t.readTemperature(msg)
+		if t.master {
+			t.vol.readMessage(msg)
+		}
 	}
 }
 
-func (t *Tank) sendUpdate(val float64) {
+// readTemperature keeps track of the vessel's thermometer and
+// publishes the time it will take to reach the heater's target.
+func (t *Tank) readTemperature(msg gogadgets.Message) {
+	if msg.Type != "update" || msg.Location != t.name || msg.Name != "temperature" {
+		return
+	}
+
+	val, ok := msg.Value.Value.(float64)
+	if !ok {
+		return
+	}
+
+	c := toCelsius(val, msg.Value.Units)
+	t.temperature = &c
+	t.sendPrediction()
+}
+
+// readCommand handles the manual volume overrides for this
+// tank, the volume manager broadcasts the new volume.
+func (t *Tank) readCommand(body string) {
+	if heat, ok, err := parseHeatCommand(body); ok && heat.vessel == t.name {
+		if err != nil {
+			log.Printf("invalid command %q: %s", body, err)
+			return
+		}
+		t.target = heat.target
+		t.sendPrediction()
+		return
+	}
+
+	cmd, ok, err := parseVolumeCommand(body)
+	if !ok || cmd.vessel != t.name {
+		return
+	}
+
+	if err != nil {
+		log.Printf("invalid command %q: %s", body, err)
+		return
+	}
+
+	switch {
+	case cmd.level && t.geometry == nil:
+		log.Printf("%s doesn't know its geometry, it can't set its level", t.name)
+	case cmd.level:
+		t.vol.set(t.name, t.geometry.Volume(cmd.cm))
+	case cmd.target:
+		if err := t.vol.fillTo(t.name, cmd.ml); err != nil {
+			log.Printf("rejected %q: %s", body, err)
+		}
+	case cmd.add:
+		t.vol.add(t.name, cmd.ml)
+	case cmd.empty:
+		t.vol.empty(t.name)
+	default:
+		t.vol.set(t.name, cmd.ml)
+	}
+}
+
+// sendPrediction publishes how many minutes the heater will
+// take to reach its target.  The value is nil when the heater
+// can't get there.  Nothing is sent unless the heater's
+// wattage is known and it has a target.
+func (t *Tank) sendPrediction() {
+	if t.thermal.Watts <= 0 || t.target == nil || t.temperature == nil {
+		return
+	}
+
+	val := gogadgets.Value{Units: "minutes"}
+	if d, ok := t.thermal.TimeTo(t.vol.get(t.name), *t.temperature, *t.target); ok {
+		val.Value = d.Minutes()
+	}
+
+	t.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    fmt.Sprintf("%s time to temperature", t.name),
+		Location:  t.name,
+		Name:      "time to temperature",
+		Type:      "update",
+		Timestamp: time.Now().UTC(),
+		Value:     val,
+		Info: gogadgets.Info{
+			Direction: "input",
+		},
+	}
+}
+
+// sendCommand lets the volume manager turn off the gadgets
+// that fill a vessel, only the master tank sends them.
+func (t *Tank) sendCommand(body string) {
 	t.out <- gogadgets.Message{
 		UUID:      gogadgets.GetUUID(),
 		Sender:    t.uid,
+		Type:      "command",
+		Body:      body,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// sendUpdate publishes the volume (ml) in the tank's units,
+// and if the geometry is known, the usable volume and the
+// level.
+func (t *Tank) sendUpdate(ml float64) {
+	t.send("volume", fromML(ml, t.units), t.units)
+	if t.geometry == nil {
+		return
+	}
+
+	t.send("usable volume", fromML(t.geometry.Usable(ml), t.units), t.units)
+
+	units := levelUnits(t.units)
+	level, _ := toCM(1, units)
+	t.send("level", t.geometry.Level(ml)/level, units)
+}
+
+func (t *Tank) send(name string, val float64, units string) {
+	sender := t.uid
+	if name != "volume" {
+		sender = fmt.Sprintf("%s %s", t.name, name)
+	}
+
+	t.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    sender,
 		Location:  t.name,
-		Name:      "volume",
+		Name:      name,
 		Type:      "update",
 		Timestamp: time.Now().UTC(),
 		Value: gogadgets.Value{
 			Value: val,
-			Units: "gallons",
+			Units: units,
 		},
 		Info: gogadgets.Info{
 			Direction: "input",
 		},
 	}
 }
+
+// sendUncertainty publishes how far off (in the tank's units)
+// the volume could be, so that it can be shown as 5.2 ± 0.3
+// gallons.
+func (t *Tank) sendUncertainty(ml float64) {
+	t.uncertainty = ml
+	t.send("volume uncertainty", fromML(ml, t.units), t.units)
+}
@@ -0,0 +1,107 @@
+package brewery
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	waterHeatCapacity = 4.186  //J/(ml C)
+	latentHeat        = 2257.0 //J/ml to boil water off
+
+	defaultAmbient      = 20.0   //C
+	defaultHeatCapacity = 2500.0 //J/C, about 5kg of stainless
+	defaultLoss         = 5.0    //W/C
+	defaultBoil         = 100.0  //C
+)
+
+// ThermalModel describes how the water in a vessel heats up
+// and cools down.  The temperature T of V ml of water changes
+// as
+//
+//	dT/dt = (watts - loss * (T - ambient)) / (V * 4.186 + heat capacity)
+//
+// until it boils, after that the heat boils water off instead.
+// Temperatures are C.
+type ThermalModel struct {
+	//Watts is the power of the vessel's heater.
+	Watts float64 `json:"watts,omitempty"`
+
+	//Loss (W/C) is the heat lost to the room for every degree
+	//the water is above Ambient.
+	Loss    float64 `json:"loss,omitempty"`
+	Ambient float64 `json:"ambient,omitempty"`
+
+	//HeatCapacity (J/C) is that of the empty vessel.
+	HeatCapacity float64 `json:"heat_capacity,omitempty"`
+
+	//Boil is the boiling point of the water, 100 by default
+	//(it is lower at altitude).
+	Boil float64 `json:"boil,omitempty"`
+}
+
+// withDefaults fills in everything but Watts.
+func (m ThermalModel) withDefaults() ThermalModel {
+	if m.Loss == 0 {
+		m.Loss = defaultLoss
+	}
+	if m.Ambient == 0 {
+		m.Ambient = defaultAmbient
+	}
+	if m.HeatCapacity == 0 {
+		m.HeatCapacity = defaultHeatCapacity
+	}
+	if m.Boil == 0 {
+		m.Boil = defaultBoil
+	}
+	return m
+}
+
+// capacity is the heat capacity (J/C) of the vessel with ml of
+// water in it.
+func (m ThermalModel) capacity(ml float64) float64 {
+	return ml*waterHeatCapacity + m.HeatCapacity
+}
+
+// Step returns the temperature of ml of water at c after dt
+// with the heater putting in watts.  The water never gets
+// hotter than Boil, see Evaporated.
+func (m ThermalModel) Step(ml, c, watts float64, dt time.Duration) float64 {
+	m = m.withDefaults()
+	final := m.Ambient + watts/m.Loss
+	return math.Min(final-(final-c)*math.Exp(-dt.Seconds()*m.Loss/m.capacity(ml)), m.Boil)
+}
+
+// Evaporated is how much (ml) of ml of boiling water the heater
+// boils off in dt, which is whatever it puts in above the heat
+// lost to the room.
+func (m ThermalModel) Evaporated(ml, c, watts float64, dt time.Duration) float64 {
+	m = m.withDefaults()
+	if c < m.Boil {
+		return 0
+	}
+
+	surplus := watts - m.Loss*(m.Boil-m.Ambient)
+	if surplus <= 0 {
+		return 0
+	}
+	return math.Min(ml, surplus*dt.Seconds()/latentHeat)
+}
+
+// TimeTo predicts how long the heater takes to bring ml of
+// water from c to target.  It is false if the heater can't
+// keep up with the losses at target.
+func (m ThermalModel) TimeTo(ml, c, target float64) (time.Duration, bool) {
+	m = m.withDefaults()
+	if c >= target {
+		return 0, true
+	}
+
+	final := m.Ambient + m.Watts/m.Loss
+	if m.Watts <= 0 || target >= final || target > m.Boil {
+		return 0, false
+	}
+
+	s := -m.capacity(ml) / m.Loss * math.Log((final-target)/(final-c))
+	return time.Duration(s * float64(time.Second)), true
+}
@@ -0,0 +1,87 @@
+package brewery_test
+
+import (
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Thermal model", func() {
+	var m brewery.ThermalModel
+
+	BeforeEach(func() {
+		m = brewery.ThermalModel{Watts: 5500, Loss: 5, Ambient: 20, HeatCapacity: 2500}
+	})
+
+	It("heats water", func() {
+		ml := 7 * 3785.41
+		c := m.Step(ml, 20, 5500, 10*time.Minute)
+		Expect(c).To(BeNumerically("~", 48.71, 0.01))
+		Expect(m.Step(ml, c, 0, 10*time.Minute)).To(BeNumerically("<", c))
+	})
+
+	It("predicts the time it takes to reach a temperature", func() {
+		ml := 7 * 3785.41
+		d, ok := m.TimeTo(ml, 20, 77)
+		Expect(ok).To(BeTrue())
+		Expect(m.Step(ml, 20, m.Watts, d)).To(BeNumerically("~", 77, 1e-6))
+
+		d, ok = m.TimeTo(ml, 80, 77)
+		Expect(ok).To(BeTrue())
+		Expect(d).To(Equal(time.Duration(0)))
+	})
+
+	It("boils water off instead of getting hotter than boiling", func() {
+		ml := 7 * 3785.41
+		c := m.Step(ml, 20, 5500, 2*time.Hour)
+		Expect(c).To(Equal(100.0))
+		Expect(m.Evaporated(ml, 20, 5500, time.Hour)).To(Equal(0.0))
+
+		//5100 W over what is lost to the room
+		Expect(m.Evaporated(ml, c, 5500, time.Hour)).To(BeNumerically("~", 5100*3600/2257.0, 1e-9))
+		Expect(m.Evaporated(1000, c, 5500, time.Hour)).To(Equal(1000.0))
+
+		_, ok := m.TimeTo(ml, 20, 101)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("knows when a heater can't keep up", func() {
+		m.Watts = 100
+		_, ok := m.TimeTo(1000, 20, 77)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("publishes the time to the strike temperature from the tank", func() {
+		cfg := &brewery.Config{
+			Vessels: []brewery.Vessel{{Name: "hlt", Thermal: brewery.ThermalModel{Watts: 5500}}},
+		}
+		b, err := brewery.New(cfg)
+		Expect(err).To(BeNil())
+
+		in := make(chan gogadgets.Message)
+		out := make(chan gogadgets.Message)
+		go b.Tank("hlt").Start(out, in)
+		<-in
+
+		out <- gogadgets.Message{Type: "command", Body: "set hlt volume to 7 gallons"}
+		<-in
+
+		out <- gogadgets.Message{Type: "command", Body: "heat hlt to 170 F"}
+		out <- gogadgets.Message{
+			Type:     "update",
+			Location: "hlt",
+			Name:     "temperature",
+			Value:    gogadgets.Value{Value: 68.0, Units: "F"},
+		}
+
+		msg := <-in
+		Expect(msg.Name).To(Equal("time to temperature"))
+		Expect(msg.Value.Units).To(Equal("minutes"))
+
+		d, _ := brewery.ThermalModel{Watts: 5500}.TimeTo(7*3785.41, 20, (170-32)*5.0/9.0)
+		Expect(msg.Value.Value.(float64)).To(BeNumerically("~", d.Minutes(), 1e-9))
+	})
+})
@@ -0,0 +1,212 @@
+package brewery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Vessel declares one of the tanks in a brewery.
+type Vessel struct {
+	Name string `json:"name"`
+
+	//Capacity is the volume (gallons) of the vessel when
+	//its float switch (on Config.FloatSwitchPin) is triggered.
+	Capacity    float64 `json:"capacity"`
+	FloatSwitch bool    `json:"float_switch"`
+
+	//Switches are the level switches mounted in the vessel.
+	Switches []LevelSwitch `json:"switches,omitempty"`
+
+	//Thermal predicts how long the vessel's heater takes to
+	//reach a temperature (and heats simulated vessels).
+	Thermal ThermalModel `json:"thermal,omitempty"`
+
+	//Heater is the sender of the vessel's heater updates, as
+	//in "boiler heater".  The interlock turns it off when
+	//there is less than HeaterVolume (gallons) in the vessel.
+	Heater       string  `json:"heater,omitempty"`
+	HeaterVolume float64 `json:"heater_volume,omitempty"`
+
+	//Watchdog protects the vessel from boil overs and runaway
+	//temperatures.
+	Watchdog *WatchdogConfig `json:"watchdog,omitempty"`
+
+	//Geometry is the shape of the inside of the vessel, it is
+	//needed to turn the readings of a Pressure sensor into
+	//volume.
+	Geometry *Geometry       `json:"geometry,omitempty"`
+	Pressure *PressureConfig `json:"pressure,omitempty"`
+}
+
+// Transfer declares a gadget that moves liquid from one
+// vessel into another.  An empty From means the vessel is
+// filled from the mains.
+type Transfer struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	//Gadget is the sender of the gadget's updates, as in
+	//"tun valve".
+	Gadget string `json:"gadget"`
+
+	//Flow is how the volume moved is estimated.  Transfers
+	//from the mains don't need one.
+	Flow FlowConfig `json:"flow"`
+
+	//Meter is the gpio pin of a flow meter that measures the
+	//transfer.  When it is set Flow is only a fallback.
+	Meter string `json:"meter,omitempty"`
+
+	//Stop is the command that turns the gadget off when a
+	//target volume is reached ("stop filling <To>" by default),
+	//and Overshoot (ml) is how early to send it.
+	Stop      string  `json:"stop,omitempty"`
+	Overshoot float64 `json:"overshoot,omitempty"`
+
+	//Uncertainty is the fraction of the volume moved that
+	//the flow model (or meter) could be off by, 0.1 (or 0.02
+	//with a meter) by default.
+	Uncertainty float64 `json:"uncertainty,omitempty"`
+}
+
+// Topology is the json document that the Config.Topology
+// file contains.
+type Topology struct {
+	Vessels   []Vessel   `json:"vessels"`
+	Transfers []Transfer `json:"transfers"`
+}
+
+func (c *Config) topology() (*Topology, error) {
+	if len(c.Vessels) > 0 {
+		return &Topology{Vessels: c.Vessels, Transfers: c.Transfers}, c.validate(c.Vessels, c.Transfers)
+	}
+
+	if c.Topology == "" {
+		t := c.defaultTopology()
+		if f := t.Transfers[1].Flow; f.Type == "polynomial" && Polynomial(f.Coefficients).zero() {
+			log.Println("warning: neither BREWERY_A, BREWERY_B and BREWERY_C nor BREWERY_HLT_RADIUS and BREWERY_TUN_VALVE_RADIUS are set, the tun valve won't move any water")
+		}
+		return t, nil
+	}
+
+	f, err := os.Open(c.Topology)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var t Topology
+	if err := json.NewDecoder(f).Decode(&t); err != nil {
+		return nil, fmt.Errorf("unable to parse topology %s: %s", c.Topology, err)
+	}
+
+	return &t, c.validate(t.Vessels, t.Transfers)
+}
+
+// defaultTopology is the hlt, mash tun, boiler and carboy
+// setup that the brewery was built around.
+func (c *Config) defaultTopology() *Topology {
+	t := &Topology{
+		Vessels: []Vessel{
+			{Name: "hlt", Capacity: c.HLTCapacity, FloatSwitch: true, Thermal: ThermalModel{Watts: c.HLTWatts, Boil: c.BoilingPoint}, Heater: "hlt heater", HeaterVolume: c.HLTHeaterVolume},
+			{Name: "tun"},
+			{Name: "boiler", Thermal: ThermalModel{Watts: c.BoilerWatts, Boil: c.BoilingPoint}, Heater: "boiler heater", HeaterVolume: c.BoilerHeaterVolume},
+			{Name: "carboy"},
+		},
+		Transfers: []Transfer{
+			{To: "hlt", Gadget: "hlt valve"},
+			{From: "hlt", To: "tun", Gadget: "tun valve", Flow: c.hltFlow(), Meter: c.FlowMeterPin},
+			{From: "tun", To: "boiler", Gadget: "boiler valve", Flow: FlowConfig{Type: "timed", Time: c.BoilerFillTime}},
+			{From: "boiler", To: "carboy", Gadget: "carboy pump", Flow: FlowConfig{Type: "timed"}},
+		},
+	}
+
+	if c.HLTMaxTemperature > 0 {
+		t.Vessels[0].Watchdog = &WatchdogConfig{Max: c.HLTMaxTemperature}
+	}
+
+	if c.BoilerMaxRise > 0 {
+		t.Vessels[2].Watchdog = &WatchdogConfig{Boil: c.BoilingPoint, Rise: c.BoilerMaxRise}
+	}
+	return t
+}
+
+// hltFlow is the A, B and C curve fit when it has been
+// calibrated, otherwise a gravity drain when the hlt's geometry
+// is known.
+func (c *Config) hltFlow() FlowConfig {
+	fit := FlowConfig{Type: "polynomial", Coefficients: []float64{c.A, c.B, c.C}}
+	if !Polynomial(fit.Coefficients).zero() {
+		return fit
+	}
+
+	tank, valve := c.HLTRadius, c.TunValveRadius
+	if tank == 0 && valve == 0 {
+		tank, valve = c.MashRadius, c.MashValveRadius
+	}
+
+	if tank > 0 && valve > 0 {
+		return FlowConfig{
+			Type:        "torricelli",
+			TankRadius:  tank,
+			ValveRadius: valve,
+			Coefficient: c.HLTCoefficient,
+		}
+	}
+	return fit
+}
+
+func (c *Config) validate(vessels []Vessel, transfers []Transfer) error {
+	if len(vessels) == 0 {
+		return fmt.Errorf("a brewery needs at least one vessel")
+	}
+
+	names := map[string]bool{}
+	for _, v := range vessels {
+		if names[v.Name] {
+			return fmt.Errorf("vessel %s is declared more than once", v.Name)
+		}
+		names[v.Name] = true
+
+		for _, sw := range v.Switches {
+			if sw.Pin == "" {
+				return fmt.Errorf("a level switch in %s has no pin", v.Name)
+			}
+		}
+
+		if v.Geometry != nil {
+			if err := v.Geometry.validate(); err != nil {
+				return fmt.Errorf("the geometry of %s: %s", v.Name, err)
+			}
+		}
+	}
+
+	gadgets := map[string]bool{}
+	for _, t := range transfers {
+		if gadgets[t.Gadget] {
+			return fmt.Errorf("gadget %s is used by more than one transfer", t.Gadget)
+		}
+		gadgets[t.Gadget] = true
+
+		if t.From != "" && !names[t.From] {
+			return fmt.Errorf("transfer %s is from unknown vessel %s", t.Gadget, t.From)
+		}
+
+		if !names[t.To] {
+			return fmt.Errorf("transfer %s is to unknown vessel %s", t.Gadget, t.To)
+		}
+
+		if t.From != "" {
+			if _, err := newFlowModel(t.Flow); err != nil {
+				return fmt.Errorf("transfer %s: %s", t.Gadget, err)
+			}
+
+			if t.Flow.Type == "polynomial" && t.Meter == "" && Polynomial(t.Flow.Coefficients).zero() {
+				return fmt.Errorf("transfer %s: a polynomial flow needs coefficients", t.Gadget)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package brewery
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	gallons = "gallons"
+	liters  = "liters"
+	quarts  = "quarts"
+)
+
+// mlPer is how many ml are in one of each of the units.
+var mlPer = map[string]float64{
+	gallons: gallonsToML,
+	liters:  1000.0,
+	quarts:  gallonsToML / 4.0,
+	"ml":    1.0,
+}
+
+// volumeUnits returns the canonical name of a volume unit.
+func volumeUnits(units string) (string, error) {
+	switch strings.ToLower(units) {
+	case "gallon", "gallons", "gal":
+		return gallons, nil
+	case "liter", "liters", "litre", "litres", "l":
+		return liters, nil
+	case "quart", "quarts", "qt":
+		return quarts, nil
+	case "ml":
+		return "ml", nil
+	}
+	return "", fmt.Errorf("unknown volume units %q", units)
+}
+
+// toML converts a volume in the given units to ml, which is
+// how volume is tracked internally.
+func toML(val float64, units string) (float64, error) {
+	u, err := volumeUnits(units)
+	if err != nil {
+		return 0, err
+	}
+	return val * mlPer[u], nil
+}
+
+// ToML converts a volume in gallons, liters, quarts or ml to
+// ml, for tools like cmd/calibrate.
+func ToML(val float64, units string) (float64, error) {
+	return toML(val, units)
+}
+
+// fromML converts ml to the given (canonical) units.
+func fromML(ml float64, units string) float64 {
+	return ml / mlPer[units]
+}
+
+// toCelsius converts a temperature in F or C to C.
+func toCelsius(val float64, units string) float64 {
+	if strings.ToUpper(units) == "F" {
+		return (val - 32.0) * 5.0 / 9.0
+	}
+	return val
+}
+
+// fromCelsius converts a temperature in C to F or C.
+func fromCelsius(val float64, units string) float64 {
+	if strings.ToUpper(units) == "F" {
+		return val*9.0/5.0 + 32.0
+	}
+	return val
+}
+
+var cmPer = map[string]float64{
+	"cm":     1.0,
+	"mm":     0.1,
+	"in":     2.54,
+	"inch":   2.54,
+	"inches": 2.54,
+}
+
+// toCM converts a length in cm, mm or inches to cm.
+func toCM(val float64, units string) (float64, error) {
+	f, ok := cmPer[strings.ToLower(units)]
+	if !ok {
+		return 0, fmt.Errorf("unknown length units %q", units)
+	}
+	return val * f, nil
+}
+
+// levelUnits are what levels are reported in, inches when the
+// volume is in gallons or quarts, otherwise cm.
+func levelUnits(volume string) string {
+	if volume == gallons || volume == quarts {
+		return "inches"
+	}
+	return "cm"
+}
@@ -0,0 +1,52 @@
+package brewery_test
+
+import (
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Units", func() {
+	var (
+		in, out chan gogadgets.Message
+	)
+
+	BeforeEach(func() {
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+
+		b, err := brewery.New(&brewery.Config{Units: "liters"}, brewery.WithPoller(&FakePoller{}))
+		Expect(err).To(BeNil())
+
+		go b.Tank("tun").Start(out, in)
+		msg := <-in
+		Expect(msg.Value.Units).To(Equal("liters"))
+	})
+
+	command := func(body string) gogadgets.Value {
+		out <- gogadgets.Message{
+			Type: "command",
+			Body: body,
+		}
+		msg := <-in
+		return msg.Value
+	}
+
+	It("publishes volumes in the configured units", func() {
+		val := command("set tun volume to 1 gallon")
+		Expect(val.Units).To(Equal("liters"))
+		Expect(val.Value).To(BeNumerically("~", 3.78541, 1e-9))
+	})
+
+	It("accepts commands in any units", func() {
+		command("set tun volume to 2 liters")
+		val := command("add 4 quarts to tun")
+		Expect(val.Value).To(BeNumerically("~", 5.78541, 1e-9))
+	})
+
+	It("rejects unknown units", func() {
+		_, err := brewery.New(&brewery.Config{Units: "hogsheads"}, brewery.WithPoller(&FakePoller{}))
+		Expect(err).ToNot(BeNil())
+	})
+})
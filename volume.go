@@ -1,8 +1,9 @@
 package brewery
 
 import (
+	"fmt"
 	"log"
-	"sync"
+	"math"
 	"time"
 
 	"github.com/cswank/gogadgets"
@@ -12,6 +13,11 @@ const (
 	//volume is tracked internally in mL.
 	gallonsToML = 3785.41
 	mlToGallons = 1.0 / gallonsToML
+
+	//the fraction of the volume moved by a transfer that
+	//a flow model or a flow meter could be off by.
+	defaultFlowUncertainty  = 0.1
+	defaultMeterUncertainty = 0.02
 )
 
 type Afterer func(d time.Duration) <-chan time.Time
@@ -33,45 +39,155 @@ func (t *timer) Since() time.Duration {
 	return time.Now().Sub(t.start)
 }
 
-type fit struct {
-	a, b, c float64
-}
-
+// volumeManager keeps track of how much liquid is in each
+// vessel.  All of its state is owned by a single event loop
+// goroutine (see run), everything else (tanks, transfer
+// tickers, pollers) talks to it by sending it events.
 type volumeManager struct {
-	lock       sync.Mutex
-	updateLock sync.Mutex
-	volumes    map[string]float64
-	updates    map[string]func(float64)
-	stop       chan bool
+	events chan func()
+
+	volumes map[string]float64
+
+	//geometries of the vessels that have one, nothing is
+	//filled past their max volume.
+	geometries map[string]Geometry
+
+	//uncertainties (ml) grow as liquid is moved by estimate
+	//and go back to 0 when a vessel is measured.
+	uncertainties map[string]float64
+
+	//dirty vessels have changed since their tank last
+	//published, wake tells the tank to come and get it.
+	dirty map[string]bool
+	wake  map[string]chan struct{}
+
+	//commands are waiting to be sent by the master tank.
+	master   string
+	commands []string
+
+	//switches anchor the volumes of the vessels they are
+	//mounted in.  pollers (keyed by pin) and poller (for the
+	//legacy float switch) replace their gpio.
+	switches []*levelSwitch
+	pollers  map[string]gogadgets.Poller
+
+	//sensors measure the volume of the sensed vessels, the
+	//estimates of the transfers don't change them.  pressures
+	//(keyed by vessel) replace their adc.
+	sensors   []*pressureSensor
+	sensed    map[string]bool
+	pressures map[string]PressureSensor
+
+	//transfers are keyed by the sender of the gadget that
+	//moves the liquid.
+	transfers map[string]*transfer
+
+	after    Afterer
+	newTimer func() Timer
+	poller   gogadgets.Poller
+
+	//meters are the pollers of flow meters, keyed by the
+	//gadget of the transfer they measure.
+	meters map[string]gogadgets.Poller
+
+	state *stateFile
+
+	//fills are the transfers into each vessel since it was
+	//last measured.  A nil fill means there was more than one
+	//(or one that a flow model didn't estimate), so it can't
+	//be compared with the measurement.
+	fills       map[string]*fill
+	calibration *jsonLog
+
+	//targets are the volumes (ml) that vessels are being
+	//filled to.  A stop command is sent when a target is
+	//reached, and the overshoot past the target is learned
+	//at overshootRate.
+	targets       map[string]float64
+	overshootRate float64
+}
 
-	fit       fit
-	listening bool
+type transfer struct {
+	Transfer
+	flow      FlowModel
+	meter     *flowMeter
+	overshoot float64
+
+	//uncertainty is the fraction of the volume moved that
+	//the estimate (or meter) could be off by.
+	uncertainty float64
+
+	//the rest is only meaningful while the transfer is
+	//running.  done is closed when it stops.
+	running  bool
+	done     chan bool
+	timer    Timer
+	start    float64
+	moved    float64
+	stopping bool
+}
 
-	hltCapacity float64
+// volume is the ml moved after elapsed.  A flow meter is
+// trusted over the flow model, and the flow model can't move
+// more than was in the source when the transfer started.
+func (t *transfer) volume(elapsed time.Duration) float64 {
+	if t.meter != nil {
+		return t.meter.volume()
+	}
+	return math.Max(0, math.Min(t.flow.Volume(elapsed, t.start), t.start))
+}
 
-	after             Afterer
-	fillingTun        bool
-	fillingBoiler     bool
-	boilerFillTime    time.Duration
-	stopFillingBoiler chan bool
-	stopFillingTun    chan bool
-	timer             Timer
-	poller            gogadgets.Poller
+type fill struct {
+	gadget  string
+	flow    string
+	before  float64
+	elapsed time.Duration
 }
 
-func newVolumeManager(cfg *Config, opts ...func(*volumeManager)) (*volumeManager, error) {
+func newVolumeManager(cfg *Config, top *Topology, opts ...func(*volumeManager)) (*volumeManager, error) {
 	v := &volumeManager{
-		volumes: map[string]float64{
-			"hlt": 0.0,
-			"tun": 0.0,
-		},
-		updates:           map[string]func(float64){},
-		stop:              make(chan bool),
-		fit:               fit{a: cfg.A, b: cfg.B, c: cfg.C},
-		boilerFillTime:    time.Duration(cfg.BoilerFillTime) * time.Second,
-		stopFillingBoiler: make(chan bool),
-		stopFillingTun:    make(chan bool),
-		hltCapacity:       cfg.HLTCapacity,
+		events:        make(chan func()),
+		volumes:       map[string]float64{},
+		geometries:    map[string]Geometry{},
+		uncertainties: map[string]float64{},
+		dirty:         map[string]bool{},
+		wake:          map[string]chan struct{}{},
+		pollers:       map[string]gogadgets.Poller{},
+		sensed:        map[string]bool{},
+		pressures:     map[string]PressureSensor{},
+		transfers:     map[string]*transfer{},
+		meters:        map[string]gogadgets.Poller{},
+		state:         newStateFile(cfg),
+		fills:         map[string]*fill{},
+		calibration:   newJSONLog(cfg.CalibrationLog),
+		targets:       map[string]float64{},
+
+		overshootRate: cfg.OvershootRate,
+	}
+
+	for _, vessel := range top.Vessels {
+		v.volumes[vessel.Name] = 0.0
+		if vessel.Geometry != nil {
+			v.geometries[vessel.Name] = *vessel.Geometry
+		}
+	}
+
+	for _, t := range top.Transfers {
+		tr := &transfer{Transfer: t, overshoot: t.Overshoot}
+		if tr.Stop == "" {
+			tr.Stop = fmt.Sprintf("stop filling %s", t.To)
+		}
+		if t.From != "" {
+			var err error
+			if tr.flow, err = newFlowModel(t.Flow); err != nil {
+				return nil, err
+			}
+		}
+		v.transfers[t.Gadget] = tr
+	}
+
+	if err := v.restore(); err != nil {
+		return nil, err
 	}
 
 	for _, opt := range opts {
@@ -83,139 +199,452 @@ func newVolumeManager(cfg *Config, opts ...func(*volumeManager)) (*volumeManager
 		v.after = time.After
 	}
 
-	if v.timer == nil {
-		v.timer = &timer{}
+	if v.newTimer == nil {
+		v.newTimer = func() Timer { return &timer{} }
 	}
 
-	if v.poller == nil {
-		var err error
-		v.poller, err = newPoller(cfg)
-		if err != nil {
-			return nil, err
-		}
+	if err := v.addSwitches(cfg, top.Vessels); err != nil {
+		return nil, err
+	}
+
+	if err := v.addMeters(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := v.addPressureSensors(top.Vessels); err != nil {
+		return nil, err
+	}
+
+	for _, t := range v.transfers {
+		t.uncertainty = transferUncertainty(t)
 	}
 
+	go v.run()
+	for _, s := range v.switches {
+		go v.watch(s)
+	}
+	for _, s := range v.sensors {
+		go v.sense(s)
+	}
 	return v, nil
 }
 
+// run is the event loop.  Events must never block, they only
+// change state and wake the tanks that need to publish.
+func (v *volumeManager) run() {
+	for f := range v.events {
+		f()
+	}
+}
+
+// do runs f on the event loop and waits for it to finish.
+func (v *volumeManager) do(f func()) {
+	done := make(chan bool)
+	v.events <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// transferUncertainty is the transfer's Uncertainty, or the
+// default for how it is measured.
+func transferUncertainty(t *transfer) float64 {
+	switch {
+	case t.Uncertainty > 0:
+		return t.Uncertainty
+	case t.meter != nil:
+		return defaultMeterUncertainty
+	default:
+		return defaultFlowUncertainty
+	}
+}
+
+func (v *volumeManager) addMeters(cfg *Config) error {
+	for _, t := range v.transfers {
+		p, ok := v.meters[t.Gadget]
+		if !ok && t.Meter == "" {
+			continue
+		}
+
+		if cfg.FlowMeterKFactor <= 0 {
+			return fmt.Errorf("the flow meter for %s needs a k-factor", t.Gadget)
+		}
+
+		if !ok {
+			var err error
+			if p, err = newPoller(t.Meter, "rising"); err != nil {
+				return err
+			}
+		}
+		t.meter = newFlowMeter(p, cfg.FlowMeterKFactor)
+	}
+	return nil
+}
+
+// restore loads the volumes that were saved before the last
+// shutdown, ignoring vessels that are no longer in the topology.
+func (v *volumeManager) restore() error {
+	if v.state == nil {
+		return nil
+	}
+
+	saved, err := v.state.load()
+	if err != nil {
+		return fmt.Errorf("unable to restore volumes from %s: %s", v.state.path, err)
+	}
+
+	for k, val := range saved.Volumes {
+		if _, ok := v.volumes[k]; ok {
+			v.volumes[k] = val
+			v.uncertainties[k] = saved.Uncertainties[k]
+		}
+	}
+
+	for k, val := range saved.Overshoots {
+		if t, ok := v.transfers[k]; ok {
+			t.overshoot = val
+		}
+	}
+	return nil
+}
+
+// save snapshots the volumes to the state file whenever
+// they change.
+func (v *volumeManager) save() {
+	if v.state == nil {
+		return
+	}
+
+	st := state{
+		Volumes:       make(map[string]float64, len(v.volumes)),
+		Uncertainties: make(map[string]float64, len(v.uncertainties)),
+		Overshoots:    make(map[string]float64, len(v.transfers)),
+	}
+
+	for k, val := range v.volumes {
+		st.Volumes[k] = val
+	}
+	for k, val := range v.uncertainties {
+		st.Uncertainties[k] = val
+	}
+	for k, t := range v.transfers {
+		st.Overshoots[k] = t.overshoot
+	}
+
+	if err := v.state.save(st); err != nil {
+		log.Println("unable to save volumes", err)
+	}
+}
+
+// changed marks vessels as needing to be published and wakes
+// up their tanks.  The wake channels are buffered so this
+// never blocks, even if a tank hasn't been started.
+func (v *volumeManager) changed(keys ...string) {
+	v.save()
+	for _, k := range keys {
+		v.dirty[k] = true
+		v.notify(k)
+	}
+}
+
+func (v *volumeManager) notify(k string) {
+	select {
+	case v.wake[k] <- struct{}{}:
+	default:
+	}
+}
+
+// register is called by each tank with the channel it wants
+// to be woken up on.  The master tank also sends the commands
+// that the volume manager issues.
+func (v *volumeManager) register(k string, wake chan struct{}, master bool) {
+	v.do(func() {
+		v.wake[k] = wake
+		if master {
+			v.master = k
+		}
+	})
+}
+
 func (v *volumeManager) get(k string) float64 {
-	v.updateLock.Lock()
-	x := v.volumes[k]
-	v.updateLock.Unlock()
-	return x * mlToGallons
+	var x float64
+	v.do(func() { x = v.volumes[k] })
+	return x
 }
 
+func (v *volumeManager) uncertainty(k string) float64 {
+	var x float64
+	v.do(func() { x = v.uncertainties[k] })
+	return x
+}
+
+// pending returns the volume and its uncertainty (ml) of a
+// vessel, whether they have changed since the last call and
+// any commands the tank has to send.
+func (v *volumeManager) pending(k string) (float64, float64, bool, []string) {
+	var (
+		x, u    float64
+		changed bool
+		cmds    []string
+	)
+
+	v.do(func() {
+		x, u, changed = v.volumes[k], v.uncertainties[k], v.dirty[k]
+		delete(v.dirty, k)
+		if k == v.master {
+			cmds, v.commands = v.commands, nil
+		}
+	})
+	return x, u, changed, cmds
+}
+
+// set overrides the volume (ml) of a vessel.
 func (v *volumeManager) set(k string, val float64) {
-	v.updateLock.Lock()
-	v.volumes[k] = val * gallonsToML
-	v.updateLock.Unlock()
+	v.do(func() {
+		v.measured(k, val)
+		v.changed(k)
+	})
+}
+
+// measured sets the volume (ml) of a vessel that has been
+// measured, so it is no longer uncertain.  If a single fill
+// got it there the fill is added to the calibration log.
+func (v *volumeManager) measured(k string, val float64) {
+	f := v.fills[k]
+	delete(v.fills, k)
+	if f != nil && v.calibration != nil {
+		rec := CalibrationRecord{
+			Time:      time.Now(),
+			Gadget:    f.gadget,
+			Flow:      f.flow,
+			Vessel:    k,
+			Elapsed:   f.elapsed.Seconds(),
+			Predicted: v.volumes[k] - f.before,
+			Actual:    val - f.before,
+		}
+		if err := v.calibration.add(rec); err != nil {
+			log.Println("unable to add to the calibration log", err)
+		}
+	}
+
+	v.volumes[k] = val
+	v.uncertainties[k] = 0
+}
+
+// add adds (ml) to the volume of a vessel.  What was added
+// by hand isn't part of a fill that is being measured.
+func (v *volumeManager) add(k string, val float64) {
+	v.do(func() {
+		if f := v.fills[k]; f != nil {
+			f.before += val
+		}
+		v.volumes[k] += val
+		v.changed(k)
+	})
+}
+
+// empty sets the volume of a vessel to 0.  Nothing was
+// measured, so a fill into it is dropped rather than logged.
+func (v *volumeManager) empty(k string) {
+	v.do(func() {
+		delete(v.fills, k)
+		v.volumes[k] = 0
+		v.uncertainties[k] = 0
+		v.changed(k)
+	})
+}
+
+// fillTo sets the volume (ml) that a vessel is being filled
+// to.  The transfer that is filling it is stopped early by
+// the overshoot that has been learned from previous fills.
+// Targets past the vessel's max volume are rejected.
+func (v *volumeManager) fillTo(k string, val float64) error {
+	var err error
+	v.do(func() {
+		if max := v.geometries[k].Max(); max > 0 && val > max {
+			err = fmt.Errorf("%.0f ml would overflow %s (max %.0f ml)", val, k, max)
+			return
+		}
+		v.targets[k] = val
+	})
+	return err
 }
 
 func (v *volumeManager) readMessage(msg gogadgets.Message) {
-	if msg.Type == "update" && msg.Sender == "tun valve" && msg.Value.Value == true {
-		go v.fillTun()
-	} else if msg.Type == "update" && msg.Sender == "tun valve" && msg.Value.Value == false && v.fillingTun {
-		v.stopFillingTun <- true
-	} else if msg.Type == "update" && msg.Sender == "boiler valve" && msg.Value.Value == true {
-		go v.fillBoiler()
-	} else if msg.Type == "update" && msg.Sender == "boiler valve" && msg.Value.Value == false && v.fillingBoiler {
-		v.stopFillingBoiler <- true
-	} else if msg.Type == "update" && msg.Sender == "hlt valve" && msg.Value.Value == true {
-		go v.waitForFloatSwitch()
-	} else if msg.Type == "update" && msg.Sender == "carboy pump" && msg.Value.Value == false {
-		b := v.volumes["boiler"]
-		v.volumes["carboy"] = b
-		v.volumes["boiler"] = 0.0
-		v.updates["carboy"](v.get("carboy"))
-		v.updates["boiler"](0.0)
-	}
-}
-
-//The rate that water flows from the mash into the boiler isn't
-//known, so wait for a safe amount of time and assume all water
-//in the mash is now in the boiler.
-func (v *volumeManager) fillBoiler() {
-	v.fillingBoiler = true
-	for v.fillingBoiler {
-		select {
-		case <-v.stopFillingBoiler:
-			v.fillingBoiler = false
-		case <-time.After(v.boilerFillTime):
-			v.fillingBoiler = false
-			v.lock.Lock()
-			t := v.volumes["tun"]
-			v.volumes["boiler"] = t
-			v.volumes["tun"] = 0.0
-			v.lock.Unlock()
-			v.updates["boiler"](v.get("boiler"))
-			v.updates["tun"](0.0)
+	if msg.Type != "update" {
+		return
+	}
+
+	v.do(func() {
+		t, ok := v.transfers[msg.Sender]
+		if !ok {
+			return
 		}
+
+		if msg.Value.Value == true && !t.running {
+			v.startTransfer(t)
+		} else if msg.Value.Value == false && t.running {
+			v.stopTransfer(t)
+		}
+	})
+}
+
+func (v *volumeManager) startTransfer(t *transfer) {
+	t.running = true
+	t.done = make(chan bool)
+	v.startFill(t)
+
+	if v.wouldOverflow(t) {
+		log.Printf("%s would overflow %s, stopping it", t.Gadget, t.To)
+		v.commands = append(v.commands, t.Stop)
+		v.notify(v.master)
 	}
+	if t.From == "" {
+		//filled from the mains, the level switches are the
+		//only measurement.
+		return
+	}
+
+	if t.meter != nil {
+		t.meter.reset()
+	}
+
+	t.start = v.volumes[t.From]
+	t.moved = 0
+	t.timer = v.newTimer()
+	t.timer.Start()
+	go v.tick(t, t.done)
 }
 
-func (v *volumeManager) waitForFloatSwitch() {
-	err := v.poller.Wait()
-	if err != nil {
-		log.Println("gpio Wait() error", err)
+func (v *volumeManager) stopTransfer(t *transfer) {
+	t.running = false
+	close(t.done)
+	if t.From == "" {
+		//nothing is metered from the mains, but the target
+		//is done with and must not outlive the fill.
+		v.finishTarget(t)
 		return
 	}
 
-	v.lock.Lock()
-	v.volumes["hlt"] = v.hltCapacity * gallonsToML
-	v.lock.Unlock()
-	v.updates["hlt"](v.hltCapacity)
+	v.move(t)
+	v.finishTarget(t)
+	v.save()
 }
 
-func (v *volumeManager) register(k string, f func(float64)) {
-	v.updates[k] = f
+// wouldOverflow is true if the destination is already at
+// its max volume, or if everything in the source would take
+// it past its max and there is no target to stop it in time.
+func (v *volumeManager) wouldOverflow(t *transfer) bool {
+	max := v.geometries[t.To].Max()
+	if max <= 0 {
+		return false
+	}
+
+	if v.volumes[t.To] >= max {
+		return true
+	}
+
+	if target, ok := v.targets[t.To]; ok && target <= max {
+		return false
+	}
+	return t.From != "" && v.volumes[t.To]+v.volumes[t.From] > max
 }
 
-func (v *volumeManager) fillTun() {
-	v.fillingTun = true
-	v.lock.Lock()
-	m := map[string]float64{
-		"tun": v.volumes["tun"],
-		"hlt": v.volumes["hlt"],
+// startFill keeps track of the fills that can be compared
+// with the next measurement of the vessel.
+func (v *volumeManager) startFill(t *transfer) {
+	if _, ok := v.fills[t.From]; ok {
+		v.fills[t.From] = nil
+	}
+
+	if _, ok := v.fills[t.To]; ok || t.From == "" || t.meter != nil || v.sensed[t.To] {
+		v.fills[t.To] = nil
+		return
 	}
-	v.lock.Unlock()
-	v.timer.Start()
+	v.fills[t.To] = &fill{gadget: t.Gadget, flow: t.Flow.Type, before: v.volumes[t.To]}
+}
+
+// tick moves liquid from one vessel to another every second
+// for as long as the transfer's gadget is on.
+func (v *volumeManager) tick(t *transfer, done chan bool) {
 	for {
 		select {
-		case <-v.stopFillingTun:
-			v.fillingTun = false
-			v.getNewVolume(m)
+		case <-done:
 			return
 		case <-v.after(time.Second):
-			v.getNewVolume(m)
+			v.events <- func() {
+				if t.running && t.done == done {
+					v.move(t)
+					v.checkTarget(t)
+				}
+			}
 		}
 	}
 }
 
-func (v *volumeManager) getNewVolume(startVolumes map[string]float64) {
-	vol := v.newVolume(v.timer.Since().Seconds())
-	v.lock.Lock()
-	v.volumes["hlt"] = startVolumes["hlt"] - vol
-	v.volumes["tun"] = startVolumes["tun"] + vol
-	v.lock.Unlock()
-	v.updates["hlt"](v.get("hlt"))
-	v.updates["tun"](v.get("tun"))
+// move moves whatever the flow meter (or flow model) says
+// has moved since the last time it was called.
+func (v *volumeManager) move(t *transfer) {
+	elapsed := t.timer.Since()
+	if f := v.fills[t.To]; f != nil && f.gadget == t.Gadget {
+		f.elapsed = elapsed
+	}
+
+	delta := t.volume(elapsed) - t.moved
+	if t.meter == nil {
+		delta = math.Min(delta, v.volumes[t.From])
+	}
+	t.moved += delta
+
+	u := t.uncertainty * math.Abs(delta)
+	if !v.sensed[t.From] {
+		v.volumes[t.From] = math.Max(0, v.volumes[t.From]-delta)
+		v.uncertainties[t.From] += u
+	}
+	if !v.sensed[t.To] {
+		v.volumes[t.To] += delta
+		v.uncertainties[t.To] += u
+	}
+	v.changed(t.From, t.To)
 }
 
-func (v *volumeManager) newVolume(elapsedTime float64) float64 {
-	return v.fit.a + (v.fit.b * elapsedTime) + (v.fit.c * elapsedTime * elapsedTime)
+func (v *volumeManager) checkTarget(t *transfer) {
+	target, ok := v.targets[t.To]
+	if !ok || t.stopping || v.volumes[t.To]+t.overshoot < target {
+		return
+	}
+
+	t.stopping = true
+	v.commands = append(v.commands, t.Stop)
+	v.notify(v.master)
+}
+
+// finishTarget learns how far past the target the vessel
+// ended up once the transfer has stopped.
+func (v *volumeManager) finishTarget(t *transfer) {
+	target, ok := v.targets[t.To]
+	if ok {
+		delete(v.targets, t.To)
+	}
+
+	if ok && t.stopping {
+		t.overshoot += v.overshootRate * (v.volumes[t.To] - target)
+	}
+	t.stopping = false
 }
 
-//gpio for the float switch at the top of my hlt.  When
-//it is triggered I know how much water is in the container.
-func newPoller(cfg *Config) (gogadgets.Poller, error) {
-	pin := &gogadgets.Pin{
-		Pin:       cfg.FloatSwitchPin,
+//gpio for a float switch, like the one at the top of my hlt.
+//When it is triggered I know how much water is in the container.
+func newPoller(pin, edge string) (gogadgets.Poller, error) {
+	p := &gogadgets.Pin{
+		Pin:       pin,
 		Platform:  "rpi",
 		Direction: "in",
-		Edge:      "rising",
+		Edge:      edge,
 	}
 
-	g, err := gogadgets.NewGPIO(pin)
+	g, err := gogadgets.NewGPIO(p)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,172 @@
+package brewery
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cswank/gogadgets"
+)
+
+const (
+	defaultBoilingPoint = 100.0 //C
+	defaultNearBoil     = 3.0   //C
+	defaultRiseWindow   = time.Minute
+)
+
+// WatchdogConfig protects a vessel from boil overs and
+// runaway temperatures.  Temperatures are C.
+type WatchdogConfig struct {
+	//Within Near (3 by default) of Boil (100 by default), the
+	//heater is throttled if the temperature is rising faster
+	//than Rise (C/min).  A Rise of 0 turns this off.
+	Boil float64 `json:"boil,omitempty"`
+	Near float64 `json:"near,omitempty"`
+	Rise float64 `json:"rise,omitempty"`
+
+	//Throttle is the command that throttles the heater.  By
+	//default it is "heat <vessel> to <Boil - Near> C", a target
+	//below the temperature it is sent at, so a pwm heater backs
+	//off and holds the vessel just under the boil.
+	Throttle string `json:"throttle,omitempty"`
+
+	//Max is the temperature the heater is turned off at, 0
+	//turns this off.
+	Max float64 `json:"max,omitempty"`
+}
+
+// Watchdog is a gadget that watches the thermometers of the
+// vessels.  It throttles a heater when the vessel is about to
+// boil over, turns it off when the vessel gets too hot, and
+// sends an alert when it does either.
+type Watchdog struct {
+	vessels map[string]*watchedVessel
+	out     chan<- gogadgets.Message
+}
+
+type watchedVessel struct {
+	WatchdogConfig
+	name     string
+	stop     string
+	readings []reading
+
+	throttled, overheated bool
+}
+
+type reading struct {
+	t time.Time
+	c float64
+}
+
+func newWatchdog(top *Topology) *Watchdog {
+	w := &Watchdog{vessels: map[string]*watchedVessel{}}
+	for _, v := range top.Vessels {
+		if v.Watchdog == nil {
+			continue
+		}
+
+		wv := &watchedVessel{WatchdogConfig: *v.Watchdog, name: v.Name, stop: fmt.Sprintf("stop heating %s", v.Name)}
+		if wv.Boil == 0 {
+			wv.Boil = defaultBoilingPoint
+		}
+		if wv.Near == 0 {
+			wv.Near = defaultNearBoil
+		}
+		if wv.Throttle == "" {
+			wv.Throttle = fmt.Sprintf("heat %s to %g C", v.Name, wv.Boil-wv.Near)
+		}
+		w.vessels[v.Name] = wv
+	}
+	return w
+}
+
+func (w *Watchdog) GetUID() string {
+	return "watchdog"
+}
+
+func (w *Watchdog) GetDirection() string {
+	return "input"
+}
+
+func (w *Watchdog) Start(input <-chan gogadgets.Message, out chan<- gogadgets.Message) {
+	w.out = out
+	for msg := range input {
+		w.readMessage(msg)
+	}
+}
+
+func (w *Watchdog) readMessage(msg gogadgets.Message) {
+	v, ok := w.vessels[msg.Location]
+	if !ok || msg.Type != "update" || msg.Name != "temperature" {
+		return
+	}
+
+	val, ok := msg.Value.Value.(float64)
+	if !ok {
+		return
+	}
+
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	w.check(v, ts, toCelsius(val, msg.Value.Units))
+}
+
+func (w *Watchdog) check(v *watchedVessel, ts time.Time, c float64) {
+	rise := v.rise(ts, c)
+
+	if v.Max > 0 && c >= v.Max && !v.overheated {
+		v.overheated = true
+		w.alert(v, v.stop, fmt.Sprintf("%s is %.1f C, over its max of %.1f C", v.name, c, v.Max))
+	} else if c < v.Max {
+		v.overheated = false
+	}
+
+	near := c >= v.Boil-v.Near
+	if v.Rise > 0 && near && rise > v.Rise && !v.throttled {
+		v.throttled = true
+		w.alert(v, v.Throttle, fmt.Sprintf("%s may boil over, it is %.1f C and rising %.1f C/min", v.name, c, rise))
+	} else if !near {
+		v.throttled = false
+	}
+}
+
+// rise is the rate (C/min) the temperature has been rising
+// over the last minute.
+func (v *watchedVessel) rise(ts time.Time, c float64) float64 {
+	v.readings = append(v.readings, reading{t: ts, c: c})
+	for len(v.readings) > 1 && ts.Sub(v.readings[0].t) > defaultRiseWindow {
+		v.readings = v.readings[1:]
+	}
+
+	first := v.readings[0]
+	dt := ts.Sub(first.t).Minutes()
+	if dt <= 0 {
+		return 0
+	}
+	return (c - first.c) / dt
+}
+
+// alert sends the command that protects the vessel and lets
+// everyone know why.
+func (w *Watchdog) alert(v *watchedVessel, cmd, reason string) {
+	log.Println("watchdog:", reason)
+	now := time.Now().UTC()
+	w.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    w.GetUID(),
+		Type:      "command",
+		Body:      cmd,
+		Timestamp: now,
+	}
+
+	w.out <- gogadgets.Message{
+		UUID:      gogadgets.GetUUID(),
+		Sender:    w.GetUID(),
+		Location:  v.name,
+		Type:      "alert",
+		Body:      reason,
+		Timestamp: now,
+	}
+}
@@ -0,0 +1,90 @@
+package brewery_test
+
+import (
+	"time"
+
+	"github.com/cswank/brewery"
+	"github.com/cswank/gogadgets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watchdog", func() {
+	var (
+		in, out chan gogadgets.Message
+		start   time.Time
+	)
+
+	BeforeEach(func() {
+		cfg := &brewery.Config{
+			Vessels: []brewery.Vessel{
+				{Name: "hlt", Watchdog: &brewery.WatchdogConfig{Max: 80}},
+				{Name: "boiler", Watchdog: &brewery.WatchdogConfig{Rise: 2}},
+			},
+		}
+
+		b, err := brewery.New(cfg)
+		Expect(err).To(BeNil())
+
+		in = make(chan gogadgets.Message)
+		out = make(chan gogadgets.Message)
+		start = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+		go b.Watchdog().Start(in, out)
+	})
+
+	temperature := func(vessel string, f float64, after time.Duration) {
+		in <- gogadgets.Message{
+			Type:      "update",
+			Sender:    vessel + " temperature",
+			Location:  vessel,
+			Name:      "temperature",
+			Value:     gogadgets.Value{Value: f, Units: "F"},
+			Timestamp: start.Add(after),
+		}
+	}
+
+	It("throttles the boiler when it is about to boil over", func() {
+		temperature("boiler", 200, 0)
+		temperature("boiler", 204, 30*time.Second)
+		temperature("boiler", 207, time.Minute)
+
+		msg := <-out
+		Expect(msg.Type).To(Equal("command"))
+		Expect(msg.Body).To(Equal("heat boiler to 97 C"))
+
+		msg = <-out
+		Expect(msg.Type).To(Equal("alert"))
+		Expect(msg.Location).To(Equal("boiler"))
+		Expect(msg.Body).To(ContainSubstring("boil over"))
+
+		//it only throttles once
+		temperature("boiler", 209, 90*time.Second)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("leaves a slow boil alone", func() {
+		temperature("boiler", 205, 0)
+		temperature("boiler", 206, time.Minute)
+		temperature("boiler", 207, 2*time.Minute)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("leaves a fast rise far from boiling alone", func() {
+		temperature("boiler", 100, 0)
+		temperature("boiler", 150, time.Minute)
+		Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("turns off a runaway hlt heater", func() {
+		temperature("hlt", 170, 0)
+		temperature("hlt", 180, time.Minute)
+
+		msg := <-out
+		Expect(msg.Type).To(Equal("command"))
+		Expect(msg.Body).To(Equal("stop heating hlt"))
+
+		msg = <-out
+		Expect(msg.Type).To(Equal("alert"))
+		Expect(msg.Location).To(Equal("hlt"))
+	})
+})